@@ -0,0 +1,227 @@
+package filedictionary
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gissleh/sarfya"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	// FormatJSON is a JSON array of sarfya.DictionaryEntry.
+	FormatJSON Format = "json"
+	// FormatYAML is a YAML list of sarfya.DictionaryEntry.
+	FormatYAML Format = "yaml"
+	// FormatTSV is a table with a header row. The id, word, pos, original_pos, source and infix_indexes columns
+	// go into their fields, while every other column is the definition in the language it's named after.
+	FormatTSV Format = "tsv"
+)
+
+var ErrUnknownFormat = errors.New("unknown dictionary file format")
+
+// FormatFromPath picks the format from the file extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".tsv", ".tab":
+		return FormatTSV, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Dictionary is a sarfya.ListableDictionary that keeps all entries in memory. It only looks up the
+// headwords, so any affixes or lenitions must be looked up in a dictionary that can take them apart.
+type Dictionary struct {
+	entries []sarfya.DictionaryEntry
+	ids     map[string]int
+	words   map[string][]int
+}
+
+func (d *Dictionary) Entry(_ context.Context, id string) (*sarfya.DictionaryEntry, error) {
+	index, ok := d.ids[id]
+	if !ok {
+		return nil, sarfya.ErrDictionaryEntryNotFound
+	}
+
+	entry := d.entries[index].Copy()
+	return &entry, nil
+}
+
+// Lookup finds the entries with the search as their headword. Since only the base forms are indexed,
+// allowReef has no effect.
+func (d *Dictionary) Lookup(_ context.Context, search string, _ bool) ([]sarfya.DictionaryEntry, error) {
+	indices := d.words[normalizeHeadword(search)]
+	if len(indices) == 0 {
+		return nil, sarfya.ErrDictionaryEntryNotFound
+	}
+
+	res := make([]sarfya.DictionaryEntry, 0, len(indices))
+	for _, index := range indices {
+		res = append(res, d.entries[index].Copy())
+	}
+
+	return res, nil
+}
+
+// ListEntries lists the entries in the order they were loaded in.
+func (d *Dictionary) ListEntries(_ context.Context) ([]sarfya.DictionaryEntry, error) {
+	res := make([]sarfya.DictionaryEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		res = append(res, entry.Copy())
+	}
+
+	return res, nil
+}
+
+// New indexes the entries. Every entry must have a unique ID and a word.
+func New(entries []sarfya.DictionaryEntry) (*Dictionary, error) {
+	d := &Dictionary{
+		entries: make([]sarfya.DictionaryEntry, 0, len(entries)),
+		ids:     make(map[string]int, len(entries)),
+		words:   make(map[string][]int, len(entries)),
+	}
+
+	for i, entry := range entries {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("entry %d: missing id", i)
+		}
+		if strings.TrimSpace(entry.Word) == "" {
+			return nil, fmt.Errorf("entry %d (%s): missing word", i, entry.ID)
+		}
+		if _, ok := d.ids[entry.ID]; ok {
+			return nil, fmt.Errorf("entry %d (%s): duplicate id", i, entry.ID)
+		}
+
+		key := normalizeHeadword(entry.Word)
+		d.ids[entry.ID] = len(d.entries)
+		d.words[key] = append(d.words[key], len(d.entries))
+		d.entries = append(d.entries, entry.Copy())
+	}
+
+	return d, nil
+}
+
+// Open loads the dictionary from a file in the format given by its extension.
+func Open(path string) (*Dictionary, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file, format)
+}
+
+// Read loads the dictionary from the reader.
+func Read(reader io.Reader, format Format) (*Dictionary, error) {
+	var entries []sarfya.DictionaryEntry
+	var err error
+
+	switch format {
+	case FormatJSON:
+		err = json.NewDecoder(reader).Decode(&entries)
+	case FormatYAML:
+		err = yaml.NewDecoder(reader).Decode(&entries)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case FormatTSV:
+		entries, err = readTSV(reader)
+	default:
+		err = ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return New(entries)
+}
+
+func readTSV(reader io.Reader) ([]sarfya.DictionaryEntry, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = '\t'
+	csvReader.Comment = '#'
+	csvReader.LazyQuotes = true
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	entries := make([]sarfya.DictionaryEntry, 0, 1024)
+	for {
+		row, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		entry := sarfya.DictionaryEntry{Definitions: make(map[string]string, len(header))}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if i >= len(header) || value == "" {
+				continue
+			}
+
+			switch header[i] {
+			case "id":
+				entry.ID = value
+			case "word":
+				entry.Word = value
+			case "pos":
+				entry.PoS = value
+			case "original_pos":
+				entry.OriginalPoS = value
+			case "source":
+				entry.Source = value
+			case "infix_indexes":
+				for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+					index, err := strconv.Atoi(field)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: invalid infix index %#+v", line, field)
+					}
+
+					entry.InfixIndexes = append(entry.InfixIndexes, index)
+				}
+			default:
+				entry.Definitions[header[i]] = value
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func normalizeHeadword(word string) string {
+	word = strings.TrimSuffix(strings.TrimSpace(word), "+")
+	return strings.ReplaceAll(strings.ToLower(word), "’", "'")
+}
@@ -0,0 +1,133 @@
+package filedictionary
+
+import (
+	"context"
+	"github.com/gissleh/sarfya"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var testEntries = []sarfya.DictionaryEntry{
+	{ID: "1044", Word: "lu", PoS: "vin.", Definitions: map[string]string{"en": "be, am, is, are", "de": "sein"}},
+	{ID: "2648", Word: "uvan si", PoS: "vin.", Definitions: map[string]string{"en": "play (a game)"}, InfixIndexes: []int{5}},
+	{ID: "20", Word: "'eylan", PoS: "n.", Definitions: map[string]string{"en": "friend"}},
+	{ID: "3148", Word: "lu+", PoS: "adj.", Definitions: map[string]string{"en": "being"}},
+}
+
+func TestRead(t *testing.T) {
+	table := []struct {
+		Format Format
+		Data   string
+	}{
+		{FormatJSON, `[
+			{"id": "1044", "word": "lu", "pos": "vin.", "definitions": {"en": "be, am, is, are", "de": "sein"}},
+			{"id": "2648", "word": "uvan si", "pos": "vin.", "definitions": {"en": "play (a game)"}, "infixIndexes": [5]},
+			{"id": "20", "word": "'eylan", "pos": "n.", "definitions": {"en": "friend"}},
+			{"id": "3148", "word": "lu+", "pos": "adj.", "definitions": {"en": "being"}}
+		]`},
+		{FormatYAML, `
+- id: "1044"
+  word: lu
+  pos: vin.
+  definitions: {en: "be, am, is, are", de: sein}
+- id: "2648"
+  word: uvan si
+  pos: vin.
+  definitions: {en: play (a game)}
+  infix_indexes: [5]
+- id: "20"
+  word: "'eylan"
+  pos: n.
+  definitions: {en: friend}
+- id: "3148"
+  word: lu+
+  pos: adj.
+  definitions: {en: being}
+`},
+		{FormatTSV, "id\tword\tpos\tinfix_indexes\ten\tde\n" +
+			"# Comments are skipped.\n" +
+			"1044\tlu\tvin.\t\tbe, am, is, are\tsein\n" +
+			"2648\tuvan si\tvin.\t5\tplay (a game)\n" +
+			"20\t'eylan\tn.\t\tfriend\t\n" +
+			"3148\tlu+\tadj.\t\tbeing\n"},
+	}
+
+	for _, tt := range table {
+		t.Run(string(tt.Format), func(t *testing.T) {
+			dictionary, err := Read(strings.NewReader(tt.Data), tt.Format)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			entries, err := dictionary.ListEntries(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, testEntries, entries)
+		})
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	table := []struct {
+		Name   string
+		Format Format
+		Data   string
+		Error  string
+	}{
+		{"infix index", FormatTSV, "id\tword\tinfix_indexes\n1\ttaron\t1,x\n", "line 2: invalid infix index \"x\""},
+		{"duplicate id", FormatJSON, `[{"id": "1", "word": "taron"}, {"id": "1", "word": "uvan"}]`, "entry 1 (1): duplicate id"},
+		{"missing word", FormatYAML, "- id: \"1\"\n  word: \" \"\n", "entry 0 (1): missing word"},
+		{"missing id", FormatTSV, "id\tword\n\ttaron\n", "entry 0: missing id"},
+		{"unknown format", Format("xml"), "", ErrUnknownFormat.Error()},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.Data), tt.Format)
+			assert.EqualError(t, err, tt.Error)
+		})
+	}
+}
+
+func TestDictionary_Lookup(t *testing.T) {
+	dictionary, err := New(testEntries)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	table := []struct {
+		Search string
+		IDs    []string
+	}{
+		{"lu", []string{"1044", "3148"}},
+		{"Lu", []string{"1044", "3148"}},
+		{"lu+", []string{"1044", "3148"}},
+		{"’Eylan", []string{"20"}},
+		{"uvan si", []string{"2648"}},
+		{"uvan", nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Search, func(t *testing.T) {
+			entries, err := dictionary.Lookup(context.Background(), tt.Search, false)
+			if tt.IDs == nil {
+				assert.ErrorIs(t, err, sarfya.ErrDictionaryEntryNotFound)
+				return
+			}
+
+			ids := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				ids = append(ids, entry.ID)
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.IDs, ids)
+		})
+	}
+
+	entry, err := dictionary.Entry(context.Background(), "2648")
+	if assert.NoError(t, err) {
+		assert.Equal(t, testEntries[1], *entry)
+	}
+	_, err = dictionary.Entry(context.Background(), "0")
+	assert.ErrorIs(t, err, sarfya.ErrDictionaryEntryNotFound)
+}
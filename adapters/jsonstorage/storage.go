@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"github.com/gissleh/sarfya"
 	"os"
+	"slices"
+	"sort"
 	"sync"
 )
 
@@ -14,6 +16,8 @@ func New(path string) *Storage {
 		readOnly: false,
 		examples: make(map[string]sarfya.Example, 1024),
 		index:    make(map[string][]string, 1024),
+
+		savedQueries: make(map[string]sarfya.SavedQuery, 16),
 	}
 }
 
@@ -28,11 +32,17 @@ func FromData(path string, readOnly bool, data Data) *Storage {
 		}
 	}
 
+	if data.SavedQueries == nil {
+		data.SavedQueries = make(map[string]sarfya.SavedQuery, 16)
+	}
+
 	return &Storage{
 		path:     path,
 		readOnly: readOnly,
 		examples: data.Examples,
 		index:    data.Index,
+
+		savedQueries: data.SavedQueries,
 	}
 }
 
@@ -57,12 +67,16 @@ type Storage struct {
 	readOnly bool
 	examples map[string]sarfya.Example
 	index    map[string][]string
+
+	savedQueries map[string]sarfya.SavedQuery
 }
 
 type Data struct {
 	Examples map[string]sarfya.Example    `json:"examples"`
 	Index    map[string][]string          `json:"index"`
 	DictDefs map[string]map[string]string `json:"dictDefs"`
+
+	SavedQueries map[string]sarfya.SavedQuery `json:"savedQueries,omitempty"`
 }
 
 func (s *Storage) FindExample(ctx context.Context, id string) (*sarfya.Example, error) {
@@ -94,7 +108,7 @@ func (s *Storage) ListExamples(ctx context.Context) ([]sarfya.Example, error) {
 	return res, nil
 }
 
-func (s *Storage) FetchExamples(ctx context.Context, filter *sarfya.Filter, resolved map[int]sarfya.DictionaryEntry) ([]sarfya.Example, error) {
+func (s *Storage) FetchExamples(ctx context.Context, filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) ([]sarfya.Example, error) {
 	if !s.readOnly {
 		s.mu.Lock()
 		defer s.mu.Unlock()
@@ -102,42 +116,26 @@ func (s *Storage) FetchExamples(ctx context.Context, filter *sarfya.Filter, reso
 
 	res := make([]sarfya.Example, 0, len(s.examples))
 
-	if filter != nil && filter.SourceID != nil {
-		for _, id := range s.index["src:"+*filter.SourceID] {
-			example := s.examples[id]
-			res = append(res, example.Copy())
-		}
-	} else if filter == nil || filter.NeedFullList() {
+	keys, fullList := s.indexKeys(filter, candidates)
+	if fullList {
 		for _, example := range s.examples {
-			res = append(res, example.Copy())
+			if filter == nil || filter.CheckSource(example.Source) {
+				res = append(res, example.Copy())
+			}
 		}
 	} else {
-		strategy := filter.WordLookupStrategy(resolved)
 		hasAdded := map[string]bool{}
-		for _, entries := range strategy {
-			if len(entries) == 0 {
-				panic("filter.NeedFullList() is supposed to return true if one is empty")
-			}
-
-			var shortestList []string
-			for _, entry := range entries {
-				if len(s.index[entry.ID]) == 0 {
-					continue
-				}
-
-				if len(s.index[entry.ID]) < len(shortestList) || shortestList == nil {
-					shortestList = s.index[entry.ID]
-				}
-			}
-
-			for _, id := range shortestList {
+		for _, key := range keys {
+			for _, id := range s.index[key] {
 				if hasAdded[id] {
 					continue
 				}
 
 				hasAdded[id] = true
 				example := s.examples[id]
-				res = append(res, example.Copy())
+				if filter.CheckSource(example.Source) {
+					res = append(res, example.Copy())
+				}
 			}
 		}
 	}
@@ -145,6 +143,79 @@ func (s *Storage) FetchExamples(ctx context.Context, filter *sarfya.Filter, reso
 	return res, nil
 }
 
+// ExplainFetch lists the index keys FetchExamples would read. It returns nil if it would go through all
+// examples.
+func (s *Storage) ExplainFetch(ctx context.Context, filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) ([]string, error) {
+	if !s.readOnly {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	keys, _ := s.indexKeys(filter, candidates)
+	return keys, nil
+}
+
+// indexKeys picks the index keys to fetch the examples from, or gives fullList if all examples must be
+// checked instead.
+func (s *Storage) indexKeys(filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) (keys []string, fullList bool) {
+	if filter != nil && filter.SourceID != nil {
+		return []string{"src:" + *filter.SourceID}, false
+	} else if filter == nil || filter.NeedFullList() {
+		return nil, true
+	}
+
+	strategy := filter.WordLookupStrategy(candidates)
+	keys = make([]string, 0, len(strategy))
+	for _, sets := range strategy {
+		if len(sets) == 0 {
+			panic("filter.NeedFullList() is supposed to return true if one is empty")
+		}
+
+		// Every set must be matched, so the one with the fewest examples is enough.
+		var shortestSet []sarfya.DictionaryEntry
+		shortestLength := 0
+		for _, entries := range sets {
+			length := len(s.indexUnion(entries))
+			if length == 0 {
+				continue
+			}
+
+			if length < shortestLength || shortestSet == nil {
+				shortestSet = entries
+				shortestLength = length
+			}
+		}
+
+		for _, entry := range shortestSet {
+			if !slices.Contains(keys, entry.ID) {
+				keys = append(keys, entry.ID)
+			}
+		}
+	}
+
+	return keys, false
+}
+
+// indexUnion lists the IDs of examples that have any of the entries.
+func (s *Storage) indexUnion(entries []sarfya.DictionaryEntry) []string {
+	if len(entries) == 1 {
+		return s.index[entries[0].ID]
+	}
+
+	seen := make(map[string]bool, 64)
+	res := make([]string, 0, 64)
+	for _, entry := range entries {
+		for _, id := range s.index[entry.ID] {
+			if !seen[id] {
+				seen[id] = true
+				res = append(res, id)
+			}
+		}
+	}
+
+	return res
+}
+
 func (s *Storage) ListExamplesForEntry(ctx context.Context, entryID string) ([]sarfya.Example, error) {
 	if !s.readOnly {
 		s.mu.Lock()
@@ -164,6 +235,31 @@ func (s *Storage) ListExamplesBySource(ctx context.Context, sourceID string) ([]
 	return s.ListExamplesForEntry(ctx, "src:"+sourceID)
 }
 
+// ListSources lists the sources of all examples, ordered by ID.
+func (s *Storage) ListSources(ctx context.Context) ([]sarfya.Source, error) {
+	if !s.readOnly {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	sources := make(map[string]sarfya.Source, 64)
+	for _, example := range s.examples {
+		if existing, ok := sources[example.Source.ID]; !ok || existing.Title == "" {
+			sources[example.Source.ID] = example.Source
+		}
+	}
+
+	res := make([]sarfya.Source, 0, len(sources))
+	for _, source := range sources {
+		res = append(res, source)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+
+	return res, nil
+}
+
 func (s *Storage) SaveExample(ctx context.Context, example sarfya.Example) error {
 	if s.readOnly {
 		return sarfya.ErrReadOnly
@@ -195,6 +291,62 @@ func (s *Storage) DeleteExample(ctx context.Context, example sarfya.Example) err
 	return nil
 }
 
+func (s *Storage) FindSavedQuery(ctx context.Context, id string) (*sarfya.SavedQuery, error) {
+	if !s.readOnly {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	query, ok := s.savedQueries[id]
+	if !ok {
+		return nil, sarfya.ErrSavedQueryNotFound
+	}
+
+	return &query, nil
+}
+
+func (s *Storage) ListSavedQueries(ctx context.Context) ([]sarfya.SavedQuery, error) {
+	if !s.readOnly {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	res := make([]sarfya.SavedQuery, 0, len(s.savedQueries))
+	for _, query := range s.savedQueries {
+		res = append(res, query)
+	}
+
+	return res, nil
+}
+
+func (s *Storage) SaveSavedQuery(ctx context.Context, query sarfya.SavedQuery) error {
+	if s.readOnly {
+		return sarfya.ErrReadOnly
+	}
+
+	s.mu.Lock()
+	s.savedQueries[query.ID] = query
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Storage) DeleteSavedQuery(ctx context.Context, query sarfya.SavedQuery) error {
+	if s.readOnly {
+		return sarfya.ErrReadOnly
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.savedQueries[query.ID]; !ok {
+		return sarfya.ErrSavedQueryNotFound
+	}
+
+	delete(s.savedQueries, query.ID)
+	return nil
+}
+
 func (s *Storage) WriteToFile() error {
 	data := Data{
 		Examples: make(map[string]sarfya.Example, 1024),
@@ -227,6 +379,12 @@ func (s *Storage) WriteToFile() error {
 	for key, index := range s.index {
 		data.Index[key] = append(make([]string, 0, len(index)), index...)
 	}
+	if len(s.savedQueries) > 0 {
+		data.SavedQueries = make(map[string]sarfya.SavedQuery, len(s.savedQueries))
+		for id, query := range s.savedQueries {
+			data.SavedQueries[id] = query
+		}
+	}
 	s.mu.Unlock()
 
 	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
@@ -0,0 +1,104 @@
+package jsonstorage
+
+import (
+	"context"
+	"github.com/gissleh/sarfya"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var entryUvan = sarfya.DictionaryEntry{ID: "2644", Word: "uvan", PoS: "n.", Definitions: map[string]string{"en": "game"}}
+
+func TestStorage_WriteToFile(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/data.json"
+
+	example := sarfya.Example{
+		ID:           "test-0001",
+		Text:         sarfya.ParseSentence("1Uvan."),
+		Translations: map[string]sarfya.Sentence{"en": sarfya.ParseSentence("1Game.")},
+		Annotations:  []sarfya.Annotation{},
+		Words:        map[int][]sarfya.DictionaryEntry{1: {entryUvan}},
+		Source:       sarfya.Source{ID: "a", Title: "Alpha", Date: "2024-01-01", URL: "https://example.com/a"},
+	}
+	query := sarfya.SavedQuery{
+		ID:        "q1",
+		Name:      "Games",
+		Filter:    "uvan",
+		Owner:     "a",
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	storage := New(path)
+	if !assert.NoError(t, storage.SaveExample(ctx, example)) || !assert.NoError(t, storage.SaveSavedQuery(ctx, query)) {
+		return
+	}
+	if !assert.NoError(t, storage.WriteToFile()) {
+		return
+	}
+
+	reloaded, err := Open(path, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	found, err := reloaded.FindExample(ctx, example.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, example, *found)
+	}
+	examples, err := reloaded.ListExamplesForEntry(ctx, entryUvan.ID)
+	if assert.NoError(t, err) && assert.Len(t, examples, 1) {
+		assert.Equal(t, example.ID, examples[0].ID)
+	}
+
+	foundQuery, err := reloaded.FindSavedQuery(ctx, query.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, query, *foundQuery)
+	}
+
+	// A deleted saved query stays deleted after the next write.
+	if !assert.NoError(t, reloaded.DeleteSavedQuery(ctx, query)) || !assert.NoError(t, reloaded.WriteToFile()) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.False(t, strings.Contains(string(data), "savedQueries"))
+	}
+
+	reloaded, err = Open(path, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	queries, err := reloaded.ListSavedQueries(ctx)
+	if assert.NoError(t, err) {
+		assert.Empty(t, queries)
+	}
+	assert.NoError(t, reloaded.SaveSavedQuery(ctx, query))
+}
+
+func TestStorage_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/data.json"
+	storage := New(path)
+	if !assert.NoError(t, storage.SaveSavedQuery(ctx, sarfya.SavedQuery{ID: "q1", Name: "Games", Filter: "uvan"})) {
+		return
+	}
+	if !assert.NoError(t, storage.WriteToFile()) {
+		return
+	}
+
+	readOnly, err := Open(path, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	queries, err := readOnly.ListSavedQueries(ctx)
+	if assert.NoError(t, err) && assert.Len(t, queries, 1) {
+		assert.Equal(t, "q1", queries[0].ID)
+	}
+	assert.ErrorIs(t, readOnly.SaveSavedQuery(ctx, sarfya.SavedQuery{ID: "q2"}), sarfya.ErrReadOnly)
+	assert.ErrorIs(t, readOnly.DeleteSavedQuery(ctx, queries[0]), sarfya.ErrReadOnly)
+}
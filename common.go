@@ -1,5 +1,10 @@
 package sarfya
 
+import (
+	"slices"
+	"time"
+)
+
 type Source struct {
 	ID     string `json:"id,omitempty" yaml:"id,omitempty"`
 	Date   string `json:"date,omitempty" yaml:"date,omitempty"`
@@ -8,15 +13,20 @@ type Source struct {
 	Author string `json:"author,omitempty" yaml:"author,omitempty"`
 }
 
+// SavedQuery is a named filter that can be run again later, like for a lesson plan.
+type SavedQuery struct {
+	ID          string    `json:"id" yaml:"id"`
+	Name        string    `json:"name" yaml:"name"`
+	Filter      string    `json:"filter" yaml:"filter"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty" yaml:"owner,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" yaml:"created_at"`
+}
+
 type ExampleFlag string
 
 func (f ExampleFlag) Valid() bool {
-	switch f {
-	case EFPoetry, EFNonCanon, EFUserTranslation, EFReefDialect, EFProverb, EFSlang, EFFormal, EFSyntax, EFClipped, EFTranscribed:
-		return true
-	default:
-		return false
-	}
+	return slices.Contains(exampleFlags, f)
 }
 
 const (
@@ -45,6 +55,9 @@ const (
 	EFTranscribed ExampleFlag = "transcribed"
 )
 
+// exampleFlags are all the valid flags, in the order they are suggested in.
+var exampleFlags = []ExampleFlag{EFPoetry, EFNonCanon, EFUserTranslation, EFReefDialect, EFProverb, EFSlang, EFFormal, EFSyntax, EFClipped, EFTranscribed}
+
 type Annotation struct {
 	Kind  AnnotationKind   `json:"kind" yaml:"kind"`
 	Links map[string][]int `json:"links" yaml:"links"`
@@ -70,7 +83,7 @@ func (a *Annotation) Validate() bool {
 		}
 
 		count := 0
-		for _, key := range []string{"subject", "predicate", "agent", "patient", "adverb", "adverbial", "dative"} {
+		for _, key := range verbParameterKeys {
 			if _, ok := a.Links[key]; ok {
 				count += 1
 			}
@@ -87,6 +100,12 @@ func (a *Annotation) Validate() bool {
 	}
 }
 
+// verbParameterKeys are the keys an AKVerbParameters annotation can link besides the verb itself.
+var verbParameterKeys = []string{"subject", "predicate", "agent", "patient", "adverb", "adverbial", "dative"}
+
+// annotationLinkKeys are all keys that annotations can link words with.
+var annotationLinkKeys = append([]string{"verb", "si", "noun"}, verbParameterKeys...)
+
 type AnnotationKind string
 
 const (
@@ -0,0 +1,137 @@
+package sarfya
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ConcordanceOptions sets how much context Concordance includes around each span.
+type ConcordanceOptions struct {
+	// LeftWidth is the number of words to include before the span.
+	LeftWidth int `json:"leftWidth"`
+	// RightWidth is the number of words to include after the span.
+	RightWidth int `json:"rightWidth"`
+}
+
+// ConcordanceLine is one span of a FilterMatch in a keyword-in-context view.
+type ConcordanceLine struct {
+	ExampleID string                    `json:"exampleId"`
+	Span      int                       `json:"span"`
+	Left      []FilterMatchCompactChunk `json:"left"`
+	Match     []FilterMatchCompactChunk `json:"match"`
+	Right     []FilterMatchCompactChunk `json:"right"`
+}
+
+// LeftText is the text of the left context without the space next to the match.
+func (l *ConcordanceLine) LeftText() string {
+	return strings.TrimRight(concordanceText(l.Left), " ")
+}
+
+func (l *ConcordanceLine) MatchText() string {
+	return strings.TrimSpace(concordanceText(l.Match))
+}
+
+// RightText is the text of the right context without the space next to the match.
+func (l *ConcordanceLine) RightText() string {
+	return strings.TrimLeft(concordanceText(l.Right), " ")
+}
+
+// Concordance gives a line for each span with the words around it as context. The context can cross
+// sentence boundaries and line breaks, but not go beyond the example. A span that skips words, like
+// with `+>>`, includes the skipped words in the match.
+func (fm *FilterMatch) Concordance(options ConcordanceOptions) []ConcordanceLine {
+	text := fm.Text
+	chunks := make([]FilterMatchCompactChunk, 0, len(text))
+	for _, line := range generateLines(text, fm.Words, fm.Spans, nil) {
+		chunks = append(chunks, line...)
+	}
+	for i := range chunks {
+		if text[i].Newline && i > 0 {
+			chunks[i].Text = " " + chunks[i].Text
+		}
+	}
+
+	res := make([]ConcordanceLine, 0, len(fm.Spans))
+	for i, span := range fm.Spans {
+		if len(span) == 0 {
+			continue
+		}
+
+		first, last := span[0], span[0]
+		for _, index := range span {
+			first = min(first, index)
+			last = max(last, index)
+		}
+
+		leftStart := first
+		for j := 0; j < options.LeftWidth; j++ {
+			prev := text.PrevLinked(leftStart, true)
+			if prev == -1 {
+				leftStart = 0
+				break
+			}
+
+			leftStart = prev
+		}
+
+		rightEnd := last
+		for j := 0; j < options.RightWidth; j++ {
+			next := text.NextLinked(rightEnd, true)
+			if next == -1 {
+				rightEnd = len(text) - 1
+				break
+			}
+
+			rightEnd = next
+		}
+
+		res = append(res, ConcordanceLine{
+			ExampleID: fm.ID,
+			Span:      i,
+			Left:      chunks[leftStart:first],
+			Match:     chunks[first : last+1],
+			Right:     chunks[last+1 : rightEnd+1],
+		})
+	}
+
+	return res
+}
+
+// FormatConcordance renders the lines as plain text with the matches aligned in a column.
+func FormatConcordance(lines []ConcordanceLine) string {
+	leftWidth := 0
+	matchWidth := 0
+	for _, line := range lines {
+		leftWidth = max(leftWidth, utf8.RuneCountInString(line.LeftText()))
+		matchWidth = max(matchWidth, utf8.RuneCountInString(line.MatchText()))
+	}
+
+	sb := strings.Builder{}
+	for _, line := range lines {
+		left := line.LeftText()
+		match := line.MatchText()
+
+		lineSb := strings.Builder{}
+		lineSb.WriteString(strings.Repeat(" ", leftWidth-utf8.RuneCountInString(left)))
+		lineSb.WriteString(left)
+		lineSb.WriteString("  ")
+		lineSb.WriteString(match)
+		lineSb.WriteString(strings.Repeat(" ", matchWidth-utf8.RuneCountInString(match)))
+		lineSb.WriteString("  ")
+		lineSb.WriteString(line.RightText())
+
+		sb.WriteString(strings.TrimRight(lineSb.String(), " "))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func concordanceText(chunks []FilterMatchCompactChunk) string {
+	sb := strings.Builder{}
+	for _, chunk := range chunks {
+		sb.WriteString(chunk.Text)
+	}
+
+	return sb.String()
+}
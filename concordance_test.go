@@ -0,0 +1,54 @@
+package sarfya
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilterMatch_Concordance(t *testing.T) {
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	table := []struct {
+		Filter     string
+		LeftWidth  int
+		RightWidth int
+		Expected   string
+	}{
+		{"oe", 2, 2, "Uvan a  oe  soli lu\n"},
+		{"oe", 5, 5, "Uvan a  oe  soli lu 'o'.\n"},
+		{"oe", 0, 1, "  oe  soli\n"},
+		{"oe +>> lu", 1, 0, "a  oe soli lu\n"},
+		{"uvan:n. || 'o' || a", 1, 1, "" +
+			"      Uvan  a\n" +
+			"  lu  'o'   .\n" +
+			"Uvan  a     oe\n"},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, candidates, err := ParseFilter(context.Background(), tt.Filter, dummyDict)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			match := filter.CheckExample(*example, candidates)
+			if !assert.NotNil(t, match) {
+				return
+			}
+
+			lines := match.Concordance(ConcordanceOptions{LeftWidth: tt.LeftWidth, RightWidth: tt.RightWidth})
+			assert.Equal(t, tt.Expected, FormatConcordance(lines))
+
+			data, err := json.Marshal(lines)
+			assert.NoError(t, err)
+			var decoded []ConcordanceLine
+			assert.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, lines, decoded)
+		})
+	}
+}
@@ -11,13 +11,32 @@ type Dictionary interface {
 	Lookup(ctx context.Context, search string, allowReef bool) ([]DictionaryEntry, error)
 }
 
+// ListableDictionary is a Dictionary that can list all its entries in their base form. It is needed for
+// anything that must search the whole dictionary, like word patterns in filters. ListEntries should
+// return ErrDictionaryNotListable if it turns out that it cannot list them after all.
+type ListableDictionary interface {
+	Dictionary
+	ListEntries(ctx context.Context) ([]DictionaryEntry, error)
+}
+
+// ListDictionaryEntries lists all entries in the dictionary, or returns ErrDictionaryNotListable if
+// the dictionary does not implement ListableDictionary.
+func ListDictionaryEntries(ctx context.Context, dictionary Dictionary) ([]DictionaryEntry, error) {
+	listable, ok := dictionary.(ListableDictionary)
+	if !ok {
+		return nil, ErrDictionaryNotListable
+	}
+
+	return listable.ListEntries(ctx)
+}
+
 type DictionaryEntry struct {
 	ID           string            `json:"id,omitempty" yaml:"id,omitempty"`
 	Word         string            `json:"word" yaml:"word"`
 	PoS          string            `json:"pos" yaml:"pos"`
 	OriginalPoS  string            `json:"originalPos" yaml:"original_pos"`
 	Definitions  map[string]string `json:"definitions" yaml:"definitions"`
-	InfixIndexes []int             `json:"infixIndexes,omitempty" yaml:"infixes"`
+	InfixIndexes []int             `json:"infixIndexes,omitempty" yaml:"infix_indexes,omitempty"`
 	Source       string            `json:"source,omitempty" yaml:"source,omitempty"`
 	Prefixes     []string          `json:"prefixes,omitempty" yaml:"prefixes,omitempty"`
 	Infixes      []string          `json:"infixes,omitempty" yaml:"infixes,omitempty"`
@@ -186,6 +205,29 @@ func (c CombinedDictionary) Lookup(ctx context.Context, search string, allowReef
 	return allRes, nil
 }
 
+// ListEntries lists the entries of all the dictionaries that can list theirs. It is only an error if none of them can.
+func (c CombinedDictionary) ListEntries(ctx context.Context) ([]DictionaryEntry, error) {
+	allRes := make([]DictionaryEntry, 0, 1024)
+	listedAny := false
+	for _, dict := range c {
+		res, err := ListDictionaryEntries(ctx, dict)
+		if errors.Is(err, ErrDictionaryNotListable) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		allRes = append(allRes, res...)
+		listedAny = true
+	}
+
+	if !listedAny {
+		return nil, ErrDictionaryNotListable
+	}
+
+	return allRes, nil
+}
+
 // WithDerivedPoS takes a pass over the result and changes the PoS (part of speech) according to
 // productive derivations like -yu, -tswo and nì-. This is to make queries more useful so that
 // rolyu will now match the query "*:n.".
@@ -217,6 +259,16 @@ func (d *withPoSChanges) Lookup(ctx context.Context, search string, allowReef bo
 	return res, nil
 }
 
+func (d *withPoSChanges) ListEntries(ctx context.Context) ([]DictionaryEntry, error) {
+	res, err := ListDictionaryEntries(ctx, d.sub)
+	if err != nil {
+		return nil, err
+	}
+
+	d.alterSlice(res)
+	return res, nil
+}
+
 func (d *withPoSChanges) alterSlice(entries []DictionaryEntry) {
 	for i := range entries {
 		d.alterEntry(&entries[i])
@@ -2,12 +2,25 @@ package sarfya
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"strings"
 )
 
 type testDictionary map[string]DictionaryEntry
 
+// with gives a copy of the dictionary with the entries added.
+func (t testDictionary) with(entries ...DictionaryEntry) testDictionary {
+	res := make(testDictionary, len(t)+len(entries))
+	for key, entry := range t {
+		res[key] = entry
+	}
+	for _, entry := range entries {
+		res[entry.Word] = entry
+	}
+
+	return res
+}
+
 func (t testDictionary) Entry(_ context.Context, id string) (*DictionaryEntry, error) {
 	for _, entry := range t {
 		if entry.ID == id {
@@ -16,13 +29,26 @@ func (t testDictionary) Entry(_ context.Context, id string) (*DictionaryEntry, e
 		}
 	}
 
-	return nil, errors.New("not found")
+	return nil, ErrDictionaryEntryNotFound
 }
 
-func (t testDictionary) Lookup(_ context.Context, word string) ([]DictionaryEntry, error) {
+func (t testDictionary) Lookup(_ context.Context, word string, _ bool) ([]DictionaryEntry, error) {
 	if val, ok := t[strings.ToLower(word)]; ok {
 		return []DictionaryEntry{val.Copy()}, nil
 	}
 
-	return nil, errors.New("not found")
+	return nil, ErrDictionaryEntryNotFound
+}
+
+func (t testDictionary) ListEntries(_ context.Context) ([]DictionaryEntry, error) {
+	res := make([]DictionaryEntry, 0, len(t))
+	for _, entry := range t {
+		res = append(res, entry.Copy())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Word < res[j].Word
+	})
+
+	return res, nil
 }
@@ -4,4 +4,6 @@ import "errors"
 
 var ErrDictionaryEntryNotFound = errors.New("dictionary entry not found")
 var ErrExampleNotFound = errors.New("example not found")
+var ErrSavedQueryNotFound = errors.New("saved query not found")
 var ErrReadOnly = errors.New("modifications are not allowed")
+var ErrDictionaryNotListable = errors.New("dictionary cannot list its entries")
@@ -2,6 +2,7 @@ package sarfya
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
@@ -61,15 +62,21 @@ func NewExample(ctx context.Context, input Input, dictionary Dictionary) (*Examp
 	for id, word := range res.Text.WordMap() {
 		matches, err := dictionary.Lookup(ctx, word, allowReef)
 		if err != nil {
-			return nil, ExampleError{
+			exampleErr := ExampleError{
 				Part:    "text.wordMap",
 				Key:     fmt.Sprint(id),
 				Message: fmt.Sprintf("Word lookup \"%s\" failed: %s", word, err),
 				Words:   matches,
 			}
+			if errors.Is(err, ErrDictionaryEntryNotFound) {
+				exampleErr.Suggestions = SuggestSpellings(ctx, dictionary, word, nil)
+			}
+
+			return nil, exampleErr
 		}
 
 		filter := ParseMultiWordFilter(input.LookupFilter[id])
+		lookupCount := len(matches)
 
 		ri := 0
 		for _, match := range matches {
@@ -83,12 +90,17 @@ func NewExample(ctx context.Context, input Input, dictionary Dictionary) (*Examp
 		matches = matches[:ri]
 
 		if len(matches) == 0 {
-			return nil, ExampleError{
+			exampleErr := ExampleError{
 				Part:    "text.wordMap",
 				Key:     fmt.Sprint(id),
 				Message: fmt.Sprintf("Word \"%s\" has no matches", word),
 				Words:   matches,
 			}
+			if lookupCount == 0 {
+				exampleErr.Suggestions = SuggestSpellings(ctx, dictionary, word, nil)
+			}
+
+			return nil, exampleErr
 		}
 
 		res.Words[id] = matches
@@ -128,6 +140,9 @@ type ExampleError struct {
 	Message string            `json:"message"`
 	Link    int               `json:"link,omitempty"`
 	Words   []DictionaryEntry `json:"words,omitempty"`
+
+	// Suggestions are the dictionary words that are spelled similarly to a word that has no matches.
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 func (e ExampleError) Error() string {
@@ -33,6 +33,9 @@ var validTestInput = Input{
 var wordUvan = DictionaryEntry{ID: "2644", Word: "uvan", PoS: "n.", Definitions: map[string]string{"en": "game"}, Source: "https://wiki.learnnavi.org/index.php?title=Canon#Midsummer_Night.27s_Dream_Vocabulary (2010-01-31)", Prefixes: []string(nil), Infixes: []string(nil), Suffixes: []string(nil), Lenitions: []string(nil), Comment: []string(nil)}
 var wordUvanSoli = DictionaryEntry{ID: "2648", Word: "uvan si", PoS: "vin.", Definitions: map[string]string{"en": "play (a game)"}, Source: "https://wiki.learnnavi.org/index.php?title=Canon#Midsummer_Night.27s_Dream_Vocabulary (2010-01-31) | https://forum.learnnavi.org/index.php?msg=204535 (2010-05-06)", Prefixes: []string(nil), Infixes: []string{"ol"}, Suffixes: []string(nil), Lenitions: []string(nil), Comment: []string(nil)}
 
+// wordFpom is not used by validTestInput, so the tests that need it add it to their own dictionary.
+var wordFpom = DictionaryEntry{ID: "569", Word: "fpom", PoS: "n.", Definitions: map[string]string{"en": "well-being, happiness"}, Source: "Activist Survival Guide (2009-11-24)"}
+
 var dummyDict = testDictionary{
 	"'o'":       DictionaryEntry{ID: "6896", Word: "'o'", PoS: "adj.", Definitions: map[string]string{"en": "bringing fun, exciting"}, Source: "https://naviteri.org/2010/09/getting-to-know-you-part-3/ (2010-09-29)", Prefixes: []string(nil), Infixes: []string(nil), Suffixes: []string(nil), Lenitions: []string(nil), Comment: []string(nil)},
 	"a":         DictionaryEntry{ID: "120", Word: "a", PoS: "part.", Definitions: map[string]string{"en": "clause-level attributive marker"}, Source: "Activist Survival Guide (2009-11-24)", Prefixes: []string(nil), Infixes: []string(nil), Suffixes: []string(nil), Lenitions: []string(nil), Comment: []string(nil)},
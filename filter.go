@@ -2,688 +2,1304 @@ package sarfya
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
-// ParseFilter parses the filter and gives a list of combinations of dictionary entries that this filter could be used with.
-func ParseFilter(ctx context.Context, str string, dictionary Dictionary) (*Filter, []map[int]DictionaryEntry, error) {
-	filter := &Filter{}
-
-	longestAt := make(map[int]int)
-	nextOperator := FTOAnd
-	i := 0
-	for len(str) > 0 {
-		for key := range longestAt {
-			delete(longestAt, key)
-		}
-
-		operator := nextOperator
-		termString := str
-		nearestIndex := len(str)
-		nextStart := len(str)
-		selectedOp := FTOAnd
-		for _, alias := range operatorAliases {
-			op := alias[1]
-			match := alias[0]
-
-			opIndex := strings.Index(str, match)
-			if opIndex != -1 && opIndex <= nearestIndex && len(match) > longestAt[opIndex] {
-				selectedOp = op
-				nearestIndex = opIndex
-				longestAt[opIndex] = len(match)
-				nextStart = opIndex + len(match)
+// ParseFilter parses the filter and looks up the candidate dictionary entries for each term. The candidates
+// are keyed by the term's index, and terms without words like `*` or text terms are left out.
+func ParseFilter(ctx context.Context, str string, dictionary Dictionary) (*Filter, map[int][]DictionaryEntry, error) {
+	var languages []string
+	listed := false
+	filter, termTokens, err := parseFilter(str, func(lang string) bool {
+		if !listed {
+			entries, err := ListDictionaryEntries(ctx, dictionary)
+			if err != nil {
+				// lookupWords lists the entries again, and will report the error for the term.
+				return true
 			}
+
+			languages = definitionLanguages(entries)
+			listed = true
 		}
 
-		termString = str[:nearestIndex]
-		nextOperator = selectedOp
-		str = str[nextStart:]
+		return slices.Contains(languages, lang)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-		termString = strings.TrimSpace(termString)
+	candidates, err := filter.lookupWords(ctx, dictionary, str, termTokens)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		not := strings.HasPrefix(termString, "!")
-		if not {
-			termString = termString[1:]
-		}
+	return filter, candidates, nil
+}
 
-		if len(termString) == 0 {
-			return nil, nil, FilterParseError{
-				Term:    i,
-				Code:    "empty_query_term",
-				Message: "A filter term cannot be empty.",
-			}
+type Filter struct {
+	Terms      []FilterTerm      `json:"terms" yaml:"terms"`
+	Root       *FilterNode       `json:"root,omitempty" yaml:"root,omitempty"`
+	SourceID   *string           `json:"sourceID" yaml:"source_id"`
+	Dates      []FilterDateRange `json:"dates,omitempty" yaml:"dates,omitempty"`
+	Authors    []string          `json:"authors,omitempty" yaml:"authors,omitempty"`
+	Flags      []ExampleFlag     `json:"flags" yaml:"flags"`
+	NoAdjacent bool              `json:"noAdjacent,omitempty" yaml:"noAdjacent,omitempty"`
+}
+
+// FilterNode is a node in the filter's expression tree. A node without an operator is a leaf that
+// refers to the term at the index Term in Filter.Terms. The other nodes combine the spans of their
+// children with the operator. FTOAnd and FTOOr can have any number of children, FTONot has one and
+// the positional operators have two. For the proximity operators, the spans of their children must be
+// at most Distance linked words away.
+type FilterNode struct {
+	Operator string       `json:"op,omitempty" yaml:"op,omitempty"`
+	Term     int          `json:"term,omitempty" yaml:"term,omitempty"`
+	Distance int          `json:"distance,omitempty" yaml:"distance,omitempty"`
+	Children []FilterNode `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// String gives the canonical form of the filter. Parsing it with ParseFilterString will give a Filter
+// identical to this one.
+func (f *Filter) String() string {
+	sb := strings.Builder{}
+	writeSeparator := func() {
+		if sb.Len() > 0 {
+			sb.WriteString(" " + FTOAnd + " ")
 		}
+	}
 
-		if operator == FTOAnd {
-			if strings.HasPrefix(termString, "src:") {
-				sourceID := termString[4:]
-				filter.SourceID = &sourceID
-				continue
-			}
+	if f.SourceID != nil {
+		sb.WriteString("src:")
+		sb.WriteString(*f.SourceID)
+	}
+	for _, dateRange := range f.Dates {
+		writeSeparator()
+		sb.WriteString("date:")
+		sb.WriteString(dateRange.String())
+	}
+	for _, author := range f.Authors {
+		writeSeparator()
+		sb.WriteString("author:\"")
+		sb.WriteString(author)
+		sb.WriteString("\"")
+	}
+	for _, flag := range f.Flags {
+		writeSeparator()
+		sb.WriteString("flag:")
+		sb.WriteString(string(flag))
+	}
+	if f.NoAdjacent {
+		writeSeparator()
+		sb.WriteString("opt:noadjacent")
+	}
 
-			if strings.HasPrefix(termString, "flag:") {
-				flag := ExampleFlag(termString[5:])
-				if strings.HasPrefix(string(flag), "-") {
-					if !flag[1:].Valid() {
-						return nil, nil, FilterParseError{
-							Term: i, Code: "flag_not_understood",
-							Message: "The flag you specified is not found.",
-						}
-					}
-				} else {
-					if !flag.Valid() {
-						return nil, nil, FilterParseError{
-							Term: i, Code: "flag_not_understood",
-							Message: "The flag you specified is not found.",
-						}
-					}
-				}
+	if f.Root != nil {
+		wrap := sb.Len() > 0 && f.Root.Operator == FTOOr
+		writeSeparator()
+		f.writeNode(&sb, f.Root, wrap)
+	}
 
-				filter.Flags = append(filter.Flags, flag)
-				continue
-			}
+	return sb.String()
+}
 
-			if termString == "opt:noadjacent" || termString == "opt:no_adjacent" || termString == "option:no_adjacent" {
-				filter.NoAdjacent = true
-				continue
+func (f *Filter) writeNode(sb *strings.Builder, node *FilterNode, wrap bool) {
+	if wrap {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
+
+	switch node.Operator {
+	case "":
+		sb.WriteString(f.Terms[node.Term].String())
+	case FTONot:
+		sb.WriteString(FTONot)
+		f.writeNode(sb, &node.Children[0], true)
+	case FTOAnd, FTOOr:
+		for i := range node.Children {
+			if i > 0 {
+				sb.WriteString(" " + node.Operator + " ")
 			}
+
+			child := &node.Children[i]
+			f.writeNode(sb, child, filterOperatorPrecedence(child.Operator) <= filterOperatorPrecedence(node.Operator))
 		}
+	default:
+		left := &node.Children[0]
+		right := &node.Children[1]
+
+		f.writeNode(sb, left, filterOperatorPrecedence(left.Operator) < filterOperatorPrecedence(node.Operator))
+		sb.WriteString(" " + node.Operator)
+		if isDistanceOperator(node.Operator) {
+			sb.WriteString(strconv.Itoa(node.Distance))
+		}
+		sb.WriteString(" ")
+		f.writeNode(sb, right, filterOperatorPrecedence(right.Operator) <= filterOperatorPrecedence(node.Operator))
+	}
+}
 
-		split := strings.SplitN(termString, ":", 10)
-		if len(split) == 10 {
-			return nil, nil, FilterParseError{
-				Term:    i,
-				Code:    "too_many_constraints",
-				Message: "A filter term cannot have more than 8 constraints.",
-			}
+// Validate checks that the expression tree is well-formed and compiles the regular expressions. This is
+// only needed for filters that did not come from ParseFilterString, like the ones decoded from JSON, but
+// then it must be called before they are used to check examples.
+//
+// There is no filter string to take offsets from, so the errors point at the node by its Term and Token
+// instead. For an operator node, that is the first term below it and the operator.
+func (f *Filter) Validate() error {
+	for _, author := range f.Authors {
+		if author == "" || strings.ContainsRune(author, '"') {
+			return FilterParseError{Term: -1, Code: "author_not_understood", Message: "The author cannot be empty or contain quotes."}
+		}
+	}
+
+	if f.Root == nil {
+		return nil
+	}
+
+	return f.validateNode(f.Root)
+}
+
+// firstTerm finds the leftmost term in the node's subtree, or -1 if it has none.
+func (n *FilterNode) firstTerm() int {
+	if n.Operator == "" {
+		return n.Term
+	}
+
+	for i := range n.Children {
+		if term := n.Children[i].firstTerm(); term != -1 {
+			return term
 		}
+	}
+
+	return -1
+}
 
-		isText := strings.HasPrefix(split[0], "\"")
-		if isText {
-			split[0] = strings.Trim(split[0], "\"")
+func (f *Filter) validateNode(node *FilterNode) error {
+	// The operator nodes have no term of their own, so their errors point at the first term below them.
+	nodeError := func(code, message string) error {
+		return FilterParseError{Term: node.firstTerm(), Code: code, Message: message, Token: node.Operator}
+	}
+
+	childCount := -1
+	switch node.Operator {
+	case "":
+		if node.Term < 0 || node.Term >= len(f.Terms) || len(node.Children) > 0 {
+			return FilterParseError{Term: node.Term, Code: "invalid_tree", Message: "The term node does not refer to a term."}
+		}
+		termError := func(code, message string) error {
+			return FilterParseError{Term: node.Term, Code: code, Message: message, Token: f.Terms[node.Term].String()}
 		}
+		if term := f.Terms[node.Term]; term.IsRegex {
+			if !term.IsText {
+				return termError("invalid_tree", "A regular expression term must also be a text term.")
+			}
+			re, err := compileFilterRegexp(term.Word, term.Fold)
+			if err != nil {
+				return termError("invalid_regex", fmt.Sprintf("The regular expression is not valid: %s.", err))
+			}
 
-		if len(split) > 2 && isText {
-			return nil, nil, FilterParseError{
-				Term:    i,
-				Code:    "text_filter_constraints",
-				Message: "A text filter term cannot have constraints.",
+			f.Terms[node.Term].regexp = re
+		}
+		for _, role := range f.Terms[node.Term].Roles {
+			if !slices.Contains(annotationLinkKeys, role.Role) {
+				return termError("role_not_understood", "The term has an unknown role.")
 			}
 		}
 
-		term := FilterTerm{
-			Operator:    operator,
-			Word:        split[0],
-			Constraints: split[1:],
-			Not:         not,
-			IsText:      isText,
+		return nil
+	case FTOAnd, FTOOr:
+		if len(node.Children) < 2 {
+			return nodeError("invalid_tree", "The node needs at least two children.")
+		}
+	case FTONot:
+		childCount = 1
+	default:
+		if !isFilterOperator(node.Operator) {
+			return nodeError("invalid_tree", "The node has an unknown operator.")
 		}
-		filter.Terms = append(filter.Terms, term)
 
-		i += 1
-		if i == 8 && len(str) > 0 {
-			return nil, nil, FilterParseError{
-				Term:    i,
-				Code:    "too_many_terms",
-				Message: "A filter cannot have more than 8 terms.",
+		if isDistanceOperator(node.Operator) && node.Distance < 1 {
+			return nodeError("invalid_tree", "The proximity node needs a distance of at least 1.")
+		}
+
+		for _, child := range node.Children {
+			if child.Operator == FTONot {
+				return nodeError("misplaced_exclusion", "An excluded expression cannot be used with positional operators.")
 			}
 		}
+
+		childCount = 2
 	}
 
-	maps, err := filter.lookupWords(ctx, dictionary)
-	if err != nil {
-		return nil, nil, err
+	if childCount != -1 && len(node.Children) != childCount {
+		return nodeError("invalid_tree", fmt.Sprintf("The node needs exactly %d children.", childCount))
+	}
+
+	for i := range node.Children {
+		if err := f.validateNode(&node.Children[i]); err != nil {
+			return err
+		}
 	}
 
-	return filter, maps, nil
+	return nil
 }
 
-type Filter struct {
-	Terms      []FilterTerm  `json:"terms" yaml:"terms"`
-	SourceID   *string       `json:"sourceID" yaml:"source_id"`
-	Flags      []ExampleFlag `json:"flags" yaml:"flags"`
-	NoAdjacent bool          `json:"noAdjacent,omitempty" yaml:"noAdjacent,omitempty"`
+// CheckSource checks the src:, date: and author: terms against the example's source. Storages can use
+// it to leave out examples before checking them in full.
+func (f *Filter) CheckSource(source Source) bool {
+	return f.sourceMismatch(source) == ""
 }
 
-func (f *Filter) CheckExample(example Example, resolved map[int]DictionaryEntry) *FilterMatch {
-	spans := make([][]int, 0)
-	matches := make([][]int, 0, 16)
-	temp := make([]int, 0, 4)
-	seen := make(map[int]bool)
-	seen2 := make(map[int]bool)
-	expandableStart := 0
-	skipTo := 0
+// sourceMismatch tells why the source does not match the filter, or gives an empty string if it does.
+func (f *Filter) sourceMismatch(source Source) string {
+	if f.SourceID != nil && source.ID != *f.SourceID {
+		return "The example is not from the source given by src:."
+	}
 
-	if f.SourceID != nil && example.Source.ID != *f.SourceID {
-		return nil
+	for _, dateRange := range f.Dates {
+		if !dateRange.Check(source.Date) {
+			return "The date of the example's source is not in date:" + dateRange.String() + "."
+		}
+	}
+
+	for _, author := range f.Authors {
+		if !strings.Contains(strings.ToLower(source.Author), strings.ToLower(author)) {
+			return "The author of the example's source does not match author:\"" + author + "\"."
+		}
 	}
 
+	return ""
+}
+
+// CheckFlags checks the flag: terms against the example's flags.
+func (f *Filter) CheckFlags(example *Example) bool {
 	for _, flag := range f.Flags {
 		if strings.HasPrefix(string(flag), "-") {
 			if example.HasFlag(flag[1:]) {
-				return nil
+				return false
 			}
 		} else {
 			if !example.HasFlag(flag) {
-				return nil
+				return false
 			}
 		}
 	}
 
-	for i, term := range f.Terms {
-		if skipTo > i {
+	return true
+}
+
+// MatchExample decides whether the example matches the filter the same way CheckExample does, but it only
+// gives the spans and the matched dictionary entries. The spans refer to the example's text before the unused
+// alternatives are removed.
+//
+// If the context is done, the evaluation stops early and the example does not match. The caller should check
+// ctx.Err() to tell it apart from a real mismatch.
+func (f *Filter) MatchExample(ctx context.Context, example *Example, candidates map[int][]DictionaryEntry) ([][]int, []DictionaryEntry, bool) {
+	if !f.CheckSource(example.Source) || !f.CheckFlags(example) {
+		return nil, nil, false
+	}
+	if f.Root == nil {
+		return nil, nil, true
+	}
+
+	filterSpans, ok := f.evaluateNode(ctx, f.Root, example, candidates)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// WithoutAlts will shift the indices in-place, so no span can share its array with another.
+	spans := make([][]int, 0, len(filterSpans))
+	spanEntries := make([]filterSpanEntry, 0, len(f.Terms))
+	for _, span := range filterSpans {
+		spans = append(spans, append(span.indices[:0:0], span.indices...))
+		for _, spanEntry := range span.entries {
+			if !slices.Contains(spanEntries, spanEntry) {
+				spanEntries = append(spanEntries, spanEntry)
+			}
+		}
+	}
+	if f.NoAdjacent && hasAdjacentWords(example, spans) {
+		return nil, nil, false
+	}
+
+	sort.Slice(spanEntries, func(i, j int) bool {
+		if spanEntries[i].term == spanEntries[j].term {
+			return spanEntries[i].candidate < spanEntries[j].candidate
+		}
+
+		return spanEntries[i].term < spanEntries[j].term
+	})
+
+	var entries []DictionaryEntry
+	for _, spanEntry := range spanEntries {
+		entry := candidates[spanEntry.term][spanEntry.candidate]
+		if !slices.ContainsFunc(entries, func(e DictionaryEntry) bool { return e.ID == entry.ID }) {
+			entries = append(entries, entry.Copy())
+		}
+	}
+
+	return spans, entries, true
+}
+
+// CheckExample checks the example against the filter. The candidates are the dictionary entries each
+// term can match, as given by ParseFilter. It returns nil if the example does not match.
+func (f *Filter) CheckExample(example Example, candidates map[int][]DictionaryEntry) *FilterMatch {
+	match, _ := f.CheckExampleContext(context.Background(), example, candidates)
+	return match
+}
+
+// CheckExampleContext is like CheckExample, but it stops early with the context's error if it is done.
+func (f *Filter) CheckExampleContext(ctx context.Context, example Example, candidates map[int][]DictionaryEntry) (*FilterMatch, error) {
+	seen := make(map[int]bool)
+
+	spans, entries, ok := f.MatchExample(ctx, &example, candidates)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	example = example.Copy()
+	example.Text = example.Text.WithoutAlts(spans)
+	for lang, translation := range example.Translations {
+		example.Translations[lang] = translation.WithoutAlts(spans)
+	}
+
+	ri := 0
+	for _, span := range spans {
+		if len(span) > 0 {
+			spans[ri] = span
+			ri += 1
+		}
+	}
+	spans = spans[:ri]
+
+	translationAdjacent := make(map[string][][]int, len(example.Translations))
+	translationSpans := make(map[string][][]int, len(example.Translations))
+	ids := make([]int, 0, 8)
+	revIDs := make([]int, 0, 8)
+
+	for lang, translated := range example.Translations {
+		translationSpans[lang] = make([][]int, len(spans))
+		translationAdjacent[lang] = make([][]int, len(spans))
+
+		if len(translated) == 0 {
 			continue
 		}
 
-		matches = matches[:0]
-		failed := false
-		entry := resolved[i]
+		for i, span := range spans {
+			translationSpans[lang][i] = []int{}
+			translationAdjacent[lang][i] = []int{}
 
-		if term.IsText {
-			text := example.Text
-			if len(term.Constraints) > 0 {
-				text = example.Translations[term.Constraints[0]]
+			// Find the IDs to select with.
+			ids = ids[:0]
+			for key := range seen {
+				delete(seen, key)
 			}
-			if text != nil {
-				search := text.SearchRaw(term.Word)
-				if len(search) > 0 {
-					if len(term.Constraints) == 0 {
-						for _, v := range search {
-							matches = append(matches, v)
-						}
-					} else {
-						ids := make([]int, 0, len(search)+4)
-						matchSpan := make([]int, 0, 16)
-						for _, searchSpan := range search {
-							for _, j := range searchSpan {
-								for _, id := range text[j].IDs {
-									if seen[id] {
-										continue
-									}
-
-									seen[id] = true
-									ids = append(ids, id)
-								}
-							}
-
-							for j, part := range example.Text {
-								if !seen2[j] && part.HasAnyID(ids) {
-									seen2[j] = true
-									matchSpan = append(matchSpan, j)
-								}
-							}
-
-							if len(matchSpan) > 0 {
-								matches = append(matches, matchSpan)
-							}
-
-							for key := range seen {
-								delete(seen, key)
-							}
-						}
+			for _, index := range span {
+				part := example.Text[index]
+				for _, id := range part.IDs {
+					if seen[id] {
+						continue
 					}
+					ids = append(ids, id)
+					seen[id] = true
 				}
 			}
-		} else {
-			for id, words := range example.Words {
-				for _, word := range words {
-					matchesWord := word.ID == entry.ID || term.Word == "*"
-
-					passed := matchesWord && term.Constraints.Check(&word, true)
-					if passed == !term.Not {
-						temp = temp[:0]
-
-						for j, part := range example.Text {
-							if part.HasID(id) {
-								temp = append(temp, j)
-							}
+
+			// Select with the translation and add any unseen IDs for the adjacent list.
+			revIDs = revIDs[:0]
+			for key := range seen {
+				delete(seen, key)
+			}
+			for j, part := range example.Translations[lang] {
+				if part.HasAnyID(ids) {
+					for _, id := range part.IDs {
+						if seen[id] {
+							continue
 						}
+						revIDs = append(revIDs, id)
+						seen[id] = true
+					}
+
+					translationSpans[lang][i] = append(translationSpans[lang][i], j)
+				}
+			}
 
-						matches = append(matches, append(temp[:0:0], temp...))
+			for j, part := range example.Text {
+				isInSpan := false
+				for _, index := range span {
+					if j == index {
+						isInSpan = true
 						break
 					}
 				}
+
+				if !isInSpan && part.HasAnyID(revIDs) {
+					translationAdjacent[lang][i] = append(translationAdjacent[lang][i], j)
+				}
 			}
 		}
+	}
+
+	return &FilterMatch{
+		Example:             example,
+		Entries:             entries,
+		Spans:               spans,
+		TranslationAdjacent: translationAdjacent,
+		TranslationSpans:    translationSpans,
+		WordMap:             example.Text.WordMap(),
+	}, nil
+}
+
+// hasAdjacentWords checks whether the English translation links any span to a word outside of all the spans,
+// which is what opt:noadjacent rejects. The spans refer to the text with the alternatives, and are not changed.
+func hasAdjacentWords(example *Example, spans [][]int) bool {
+	shifted := make([][]int, 0, len(spans))
+	for _, span := range spans {
+		shifted = append(shifted, append(span[:0:0], span...))
+	}
+	text := example.Text.WithoutAlts(shifted)
+	translation := example.Translations["en"].WithoutAlts(shifted)
+
+	inSpans := make(map[int]bool, len(shifted)*2)
+	for _, span := range shifted {
+		for _, index := range span {
+			inSpans[index] = true
+		}
+	}
+
+	ids := make([]int, 0, 8)
+	revIDs := make([]int, 0, 8)
+	for _, span := range shifted {
+		ids = ids[:0]
+		for _, index := range span {
+			ids = append(ids, text[index].IDs...)
+		}
+
+		revIDs = revIDs[:0]
+		for _, part := range translation {
+			if part.HasAnyID(ids) {
+				revIDs = append(revIDs, part.IDs...)
+			}
+		}
+
+		for j, part := range text {
+			if !inSpans[j] && part.HasAnyID(revIDs) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// evaluateNode gets the spans matched by the node, and whether the node passed at all. A node can pass
+// without any spans, like an FTONot group that did not match anything.
+func (f *Filter) evaluateNode(ctx context.Context, node *FilterNode, example *Example, candidates map[int][]DictionaryEntry) ([]filterSpan, bool) {
+	select {
+	case <-ctx.Done():
+		return nil, false
+	default:
+	}
+
+	switch node.Operator {
+	case "":
+		matches := f.matchTerm(node.Term, example, candidates)
+		return matches, len(matches) > 0
+	case FTOOr:
+		spans := make([]filterSpan, 0, 4)
+		passedAny := false
+		for i := range node.Children {
+			matches, passed := f.evaluateNode(ctx, &node.Children[i], example, candidates)
+			if passed {
+				spans, _ = appendNewSpans(spans, matches)
+				passedAny = true
+			}
+		}
+
+		return spans, passedAny
+	case FTOAnd:
+		spans := make([]filterSpan, 0, 4)
+		for i := range node.Children {
+			matches, passed := f.evaluateNode(ctx, &node.Children[i], example, candidates)
+			if !passed {
+				return nil, false
+			}
+
+			// Every term needs to add something new, so `*:n. && *:n.` needs two different nouns.
+			var addedAny bool
+			spans, addedAny = appendNewSpans(spans, matches)
+			if len(matches) > 0 && !addedAny {
+				return nil, false
+			}
+		}
+
+		return spans, true
+	case FTONot:
+		_, passed := f.evaluateNode(ctx, &node.Children[0], example, candidates)
+		return []filterSpan{}, !passed
+	default:
+		spans, passed := f.evaluateNode(ctx, &node.Children[0], example, candidates)
+		if !passed {
+			return nil, false
+		}
+		matches, passed := f.evaluateNode(ctx, &node.Children[1], example, candidates)
+		if !passed {
+			return nil, false
+		}
 
-		sort.Slice(matches, func(i, j int) bool {
-			if (len(matches[i]) > 0) != (len(matches[j]) > 0) {
-				return len(matches[i]) > 0
+		spans = extendSpans(example.Text, node.Operator, node.Distance, spans, matches)
+		return spans, len(spans) > 0
+	}
+}
+
+// matchTerm finds the spans of all words in the example matching the term.
+func (f *Filter) matchTerm(i int, example *Example, candidates map[int][]DictionaryEntry) []filterSpan {
+	term := f.Terms[i]
+	matches := make([]filterSpan, 0, 4)
+
+	if term.IsText {
+		text := example.Text
+		if len(term.Constraints) > 0 {
+			text = example.Translations[term.Constraints[0]]
+		}
+		if text == nil {
+			return matches
+		}
+
+		var search [][]int
+		if term.IsRegex {
+			// Filters that were not validated must not break the matching, but they are slow to match this way.
+			re := term.regexp
+			if re == nil {
+				var err error
+				if re, err = compileFilterRegexp(term.Word, term.Fold); err != nil {
+					return matches
+				}
 			}
 
-			return matches[i][0] < matches[j][0]
-		})
+			search = text.SearchRawRegexp(re, term.Fold)
+		} else if term.Fold {
+			search = text.SearchRawFolded(term.Word)
+		} else {
+			search = text.SearchRaw(term.Word)
+		}
+		if len(term.Constraints) == 0 {
+			for _, searchSpan := range search {
+				matches = append(matches, filterSpan{indices: searchSpan})
+			}
 
-		switch term.Operator {
-		case FTOOr:
-			{
-				expandableStart = len(spans)
-				spans = append(spans, matches...)
+			return matches
+		}
+
+		seen := make(map[int]bool)
+		ids := make([]int, 0, len(search)+4)
+		for _, searchSpan := range search {
+			ids = ids[:0]
+			for _, j := range searchSpan {
+				for _, id := range text[j].IDs {
+					if seen[id] {
+						continue
+					}
+
+					seen[id] = true
+					ids = append(ids, id)
+				}
 			}
-		case FTOAnd:
-			{
-				if len(matches) == 0 {
-					failed = true
+
+			matchSpan := make([]int, 0, 16)
+			for j, part := range example.Text {
+				if part.HasAnyID(ids) {
+					matchSpan = append(matchSpan, j)
 				}
+			}
 
-				addedAny := false
-				for _, match := range matches {
-					alreadyExists := false
+			if len(matchSpan) > 0 {
+				matches, _ = appendNewSpans(matches, []filterSpan{{indices: matchSpan}})
+			}
 
-					for _, span := range spans {
-						if slices.Equal(span, match) {
-							alreadyExists = true
+			for key := range seen {
+				delete(seen, key)
+			}
+		}
+	} else {
+		termCandidates := candidates[i]
+		for id, words := range example.Words {
+			for _, word := range words {
+				candidate := -1
+				if term.Word != "*" {
+					for j := range termCandidates {
+						if word.ID == termCandidates[j].ID {
+							candidate = j
 							break
 						}
 					}
+				}
 
-					if !alreadyExists {
-						spans = append(spans, match)
-						addedAny = true
+				matchesWord := candidate != -1 || term.Word == "*"
+				passed := matchesWord && term.Constraints.Check(&word, true)
+
+				linkedIDs := make([]int, 0, 2)
+				for _, role := range term.Roles {
+					if !passed {
+						break
 					}
+
+					var roleLinkedIDs []int
+					roleLinkedIDs, passed = role.check(example, id)
+					linkedIDs = append(linkedIDs, roleLinkedIDs...)
 				}
 
-				if !addedAny {
-					failed = true
+				if passed == !term.Not {
+					match := filterSpan{indices: make([]int, 0, 2)}
+					for j, part := range example.Text {
+						if part.HasID(id) || part.HasAnyID(linkedIDs) {
+							match.indices = append(match.indices, j)
+						}
+					}
+					if candidate != -1 && !term.Not {
+						match.entries = []filterSpanEntry{{term: i, candidate: candidate}}
+					}
+
+					matches = append(matches, match)
+					break
 				}
 			}
+		}
+	}
+
+	sortSpans(matches)
+	return matches
+}
+
+// extendSpans extends the spans with the matches according to the positional operator. Spans that
+// could not be extended are left out of the result.
+func extendSpans(text Sentence, operator string, distance int, spans, matches []filterSpan) []filterSpan {
+	res := make([]filterSpan, 0, len(spans))
+	matches = append(matches[:0:0], matches...)
+	sortSpans(matches)
+
+	for _, span := range spans {
+		if len(span.indices) == 0 {
+			continue
+		}
+
+		first := span.indices[0]
+		last := span.indices[len(span.indices)-1]
+
+		switch operator {
 		case FTOEnclitic:
-			{
-				foundAny := false
+			nextLinked := text.NextLinked(last, false)
+			if nextLinked != last+1 {
+				continue
+			}
 
-				for j, span := range spans {
-					if len(span) == 0 || j < expandableStart {
-						continue
+			for _, match := range matches {
+				if nextLinked == match.first() {
+					res = append(res, joinSpans(span, match))
+					break
+				}
+			}
+		case FTOFollowedBy, FTOFollowedByAcross, FTONextTo, FTOASurroundedBy:
+			var after, before *filterSpan
+
+			nextLinked := text.NextLinked(last, operator == FTOFollowedByAcross)
+			if nextLinked != -1 {
+				for j := range matches {
+					if nextLinked == matches[j].first() {
+						after = &matches[j]
+						break
 					}
+				}
+			}
 
-					found := false
-					spanRightIndex := span[len(span)-1]
-
-					nextLinked := example.Text.NextLinked(spanRightIndex, false)
-					if nextLinked == spanRightIndex+1 {
-						for _, match := range matches {
-							if nextLinked == match[0] {
-								spans[j] = append(spans[j], match...)
-								found = true
-								foundAny = true
-								break
-							}
+			if operator != FTOFollowedBy && operator != FTOFollowedByAcross {
+				prevLinked := text.PrevLinked(first, false)
+				if prevLinked != -1 {
+					for j := range matches {
+						if prevLinked == matches[j].last() {
+							before = &matches[j]
+							break
 						}
 					}
+				}
+			}
 
-					if !found {
-						spans[j] = spans[j][:0]
+			if operator == FTOASurroundedBy && (after == nil || before == nil) {
+				continue
+			}
+			if after == nil && before == nil {
+				continue
+			}
+
+			res = append(res, joinOptionalSpans(before, span, after))
+		case FTOBefore, FTOBeforeAcross:
+			for _, match := range matches {
+				if last >= match.first() {
+					continue
+				}
+
+				foundBoundary := false
+				if operator != FTOBeforeAcross {
+					for k := last; k < match.first(); k++ {
+						if text[k].SentenceBoundary {
+							foundBoundary = true
+							break
+						}
 					}
 				}
 
-				if !foundAny {
-					failed = true
+				if !foundBoundary {
+					res = append(res, joinSpans(span, match))
+					break
 				}
 			}
-		case FTOFollowedBy, FTOFollowedByAcross, FTONextTo, FTOASurroundedBy:
-			{
-				foundAny := false
+		case FTOWithin, FTOWithinAcross, FTOWithinAfter, FTOWithinAfterAcross:
+			across := operator == FTOWithinAcross || operator == FTOWithinAfterAcross
+			var after, before *filterSpan
+
+			next := last
+			for k := 0; k < distance && after == nil; k++ {
+				next = text.NextLinked(next, across)
+				if next == -1 {
+					break
+				}
 
-				for j, span := range spans {
-					if len(span) == 0 || j < expandableStart {
-						continue
+				for j := range matches {
+					if next == matches[j].first() {
+						after = &matches[j]
+						break
 					}
+				}
+			}
 
-					matchedAfter := false
-					matchedBefore := false
-
-					nextLinked := example.Text.NextLinked(span[len(span)-1], term.Operator == FTOFollowedByAcross)
-					if nextLinked != -1 {
-						for _, match := range matches {
-							if nextLinked == match[0] {
-								spans[j] = append(spans[j], match...)
-								matchedAfter = true
-								break
-							}
+			if operator == FTOWithin || operator == FTOWithinAcross {
+				prev := first
+				for k := 0; k < distance && before == nil; k++ {
+					prev = text.PrevLinked(prev, across)
+					if prev == -1 {
+						break
+					}
+
+					for j := range matches {
+						if prev == matches[j].last() {
+							before = &matches[j]
+							break
 						}
 					}
+				}
+			}
 
-					if term.Operator != FTOFollowedBy && term.Operator != FTOFollowedByAcross {
-						prevLinked := example.Text.PrevLinked(span[0], false)
-						if prevLinked != -1 {
-							for _, match := range matches {
-								if prevLinked == match[len(match)-1] {
-									spans[j] = append(match, spans[j]...)
+			if after == nil && before == nil {
+				continue
+			}
+
+			res = append(res, joinOptionalSpans(before, span, after))
+		case FTOSurrounding:
+			if len(span.indices) < 2 {
+				continue
+			}
+
+			extended := filterSpan{
+				indices: make([]int, 0, len(span.indices)+4),
+				entries: append(span.entries[:0:0], span.entries...),
+			}
+			found := false
+			for k, index := range span.indices {
+				extended.indices = append(extended.indices, index)
+				if k == len(span.indices)-1 {
+					break
+				}
+
+				for _, match := range matches {
+					if index < match.first() && span.indices[k+1] > match.last() {
+						extended.indices = append(extended.indices, match.indices...)
+						extended.entries = append(extended.entries, match.entries...)
+						found = true
+					}
+				}
+			}
+
+			if found {
+				res = append(res, extended)
+			}
+		}
+	}
+
+	return res
+}
+
+// filterSpan is a list of indices in the sentence that matched, along with the candidates
+// of the terms that matched within it.
+type filterSpan struct {
+	indices []int
+	entries []filterSpanEntry
+}
+
+type filterSpanEntry struct {
+	term      int
+	candidate int
+}
+
+func (s *filterSpan) first() int {
+	return s.indices[0]
+}
+
+func (s *filterSpan) last() int {
+	return s.indices[len(s.indices)-1]
+}
+
+// appendNewSpans appends the spans that are not already in the list, and reports whether any were added.
+func appendNewSpans(spans []filterSpan, newSpans []filterSpan) ([]filterSpan, bool) {
+	addedAny := false
+	for _, newSpan := range newSpans {
+		alreadyExists := false
+		for _, span := range spans {
+			if slices.Equal(span.indices, newSpan.indices) {
+				alreadyExists = true
+				break
+			}
+		}
+
+		if !alreadyExists {
+			spans = append(spans, newSpan)
+			addedAny = true
+		}
+	}
+
+	return spans, addedAny
+}
+
+func joinSpans(spans ...filterSpan) filterSpan {
+	indexCount := 0
+	entryCount := 0
+	for _, span := range spans {
+		indexCount += len(span.indices)
+		entryCount += len(span.entries)
+	}
+
+	res := filterSpan{
+		indices: make([]int, 0, indexCount),
+		entries: make([]filterSpanEntry, 0, entryCount),
+	}
+	for _, span := range spans {
+		res.indices = append(res.indices, span.indices...)
+		res.entries = append(res.entries, span.entries...)
+	}
 
-									matchedBefore = true
+	return res
+}
 
-									break
-								}
-							}
-						}
-					}
+func joinOptionalSpans(before *filterSpan, span filterSpan, after *filterSpan) filterSpan {
+	spans := make([]filterSpan, 0, 3)
+	if before != nil {
+		spans = append(spans, *before)
+	}
+	spans = append(spans, span)
+	if after != nil {
+		spans = append(spans, *after)
+	}
 
-					if term.Operator == FTOASurroundedBy {
-						if !matchedAfter || !matchedBefore {
-							spans[j] = spans[j][:0]
-						} else {
-							foundAny = true
-						}
-					} else {
-						if !matchedAfter && !matchedBefore {
-							spans[j] = spans[j][:0]
-						} else {
-							foundAny = true
-						}
-					}
-				}
+	return joinSpans(spans...)
+}
 
-				if !foundAny {
-					failed = true
-				}
-			}
-		case FTOBefore, FTOBeforeAcross:
-			{
-				foundAny := false
+func sortSpans(spans []filterSpan) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if (len(spans[i].indices) > 0) != (len(spans[j].indices) > 0) {
+			return len(spans[i].indices) > 0
+		}
+		if len(spans[i].indices) == 0 {
+			return false
+		}
 
-				for j, span := range spans {
-					if j < expandableStart {
-						continue
-					}
+		return spans[i].first() < spans[j].first()
+	})
+}
 
-					var selected []int
-					for _, match := range matches {
-						if span[len(span)-1] < match[0] {
-							foundBoundary := false
-							if term.Operator != FTOBeforeAcross {
-								for k := span[len(span)-1]; k < match[0]; k++ {
-									if example.Text[k].SentenceBoundary {
-										foundBoundary = true
-										break
-									}
-								}
-							}
-
-							if !foundBoundary {
-								selected = match
-								break
-							}
-						}
-					}
+// lookupWords gets the DictionaryEntries that each term can match by the general criteria.
+// It will not check prefixes, infixes, suffixes and lenitions here. It will return an error if the
+// dictionary failed. The term tokens are used to point to the term in the original query on errors.
+func (f *Filter) lookupWords(ctx context.Context, dictionary Dictionary, str string, termTokens []filterToken) (map[int][]DictionaryEntry, error) {
+	candidates := make(map[int][]DictionaryEntry, len(f.Terms))
 
-					if selected != nil {
-						spans[j] = append(span, selected...)
-						foundAny = true
-					} else {
-						spans[j] = span[:0]
-					}
-				}
+	var allEntries []DictionaryEntry
+	for i, term := range f.Terms {
+		if term.Word == "*" || term.IsText {
+			continue
+		}
 
-				if !foundAny {
-					failed = true
+		var entries []DictionaryEntry
+		if term.IsPattern() || term.DefinitionLang != "" {
+			if allEntries == nil {
+				var err error
+				allEntries, err = ListDictionaryEntries(ctx, dictionary)
+				if errors.Is(err, ErrDictionaryNotListable) && term.DefinitionLang != "" {
+					return nil, newFilterParseError(str, termTokens[i], i, "definition_search_not_supported",
+						"The dictionary does not support searching by definition.",
+					)
+				} else if errors.Is(err, ErrDictionaryNotListable) {
+					return nil, newFilterParseError(str, termTokens[i], i, "pattern_not_supported",
+						"The dictionary does not support word patterns.",
+					)
+				} else if err != nil {
+					return nil, err
 				}
 			}
-		case FTOSurrounding:
-			{
-				foundAny := false
-
-				for j, span := range spans {
-					if len(span) >= 2 && j >= expandableStart {
-						found := false
-
-						temp = temp[:0]
-						for k := range span[:len(span)-1] {
-							for _, match := range matches {
-								if span[k] < match[0] && span[k+1] > match[len(match)-1] {
-									temp = append(temp, match...)
-									foundAny = true
-									found = true
-								}
-							}
-
-							if len(temp) > 0 {
-								spans[j] = append(span[:k+1], append(temp, span[k+1:]...)...)
-							}
-						}
+		}
 
-						if !found {
-							spans[j] = span[:0]
-						}
-					} else {
-						spans[j] = span[:0]
-					}
+		if term.DefinitionLang != "" {
+			entries = lookupDefinition(allEntries, term.DefinitionLang, term.Word)
+		} else if term.IsPattern() {
+			seen := make(map[string]bool)
+			for _, entry := range allEntries {
+				if !seen[entry.ID] && matchWordPattern(term.Word, strings.TrimSuffix(entry.Word, "+")) {
+					seen[entry.ID] = true
+					entries = append(entries, entry.Copy())
 				}
+			}
+		} else {
+			var err error
+			entries, err = dictionary.Lookup(ctx, term.Word, true)
+			if err != nil && !errors.Is(err, ErrDictionaryEntryNotFound) {
+				return nil, err
+			}
+		}
 
-				if !foundAny {
-					failed = true
-				}
+		// Only the ID is needed to match the words, so entries with different affixes are redundant.
+		filteredEntries := entries[:0]
+		for _, entry := range entries {
+			if term.Constraints.Check(&entry, false) && !slices.ContainsFunc(filteredEntries, func(e DictionaryEntry) bool { return e.ID == entry.ID }) {
+				filteredEntries = append(filteredEntries, entry)
 			}
-		default:
-			failed = true
 		}
 
-		if failed {
-			orOffset := -1
-			for j, term2 := range f.Terms[i+1:] {
-				if term2.Operator == FTOOr {
-					orOffset = j + 1
-					break
-				}
+		if len(filteredEntries) == 0 {
+			parseErr := newFilterParseError(str, termTokens[i], i, "no_matched_entries",
+				fmt.Sprintf("No dictionary entry matched word or constraints of %+v", term.Word),
+			)
+			if len(entries) == 0 && !term.IsPattern() && term.DefinitionLang == "" {
+				parseErr.Suggestions = SuggestSpellings(ctx, dictionary, term.Word, func(entry *DictionaryEntry) bool {
+					return term.Constraints.Check(entry, false)
+				})
 			}
 
-			if orOffset != -1 {
-				skipTo = i + orOffset
-				spans = spans[:0]
-				expandableStart = 0
-			} else {
-				return nil
+			return nil, parseErr
+		}
+
+		candidates[i] = filteredEntries
+	}
+
+	return candidates, nil
+}
+
+// definitionLanguages lists the languages the entries have definitions in, in alphabetical order.
+func definitionLanguages(entries []DictionaryEntry) []string {
+	res := make([]string, 0, 8)
+	for _, entry := range entries {
+		for lang, definition := range entry.Definitions {
+			if definition != "" && !slices.Contains(res, lang) {
+				res = append(res, lang)
 			}
 		}
 	}
+	sort.Strings(res)
 
-	example = example.Copy()
-	example.Text = example.Text.WithoutAlts(spans)
-	for lang, translation := range example.Translations {
-		example.Translations[lang] = translation.WithoutAlts(spans)
+	return res
+}
+
+// lookupDefinition finds the entries where the search is one of the senses of the definition in the language.
+// If there are none, it will instead find the entries where the words of the search are found in a row.
+func lookupDefinition(entries []DictionaryEntry, lang, search string) []DictionaryEntry {
+	searchSense := normalizeDefinitionSense(search)
+	searchWords := definitionWords(search)
+	if len(searchWords) == 0 {
+		return nil
 	}
 
-	ri := 0
-	for _, span := range spans {
-		if len(span) > 0 {
-			spans[ri] = span
-			ri += 1
+	exact := make([]DictionaryEntry, 0, 8)
+	partial := make([]DictionaryEntry, 0, 8)
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		definition := entry.Definitions[lang]
+		if definition == "" || seen[entry.ID] {
+			continue
+		}
+
+		if slices.ContainsFunc(strings.FieldsFunc(definition, isDefinitionSenseSeparator), func(sense string) bool {
+			return normalizeDefinitionSense(sense) == searchSense
+		}) {
+			seen[entry.ID] = true
+			exact = append(exact, entry.Copy())
+		} else if len(exact) == 0 && containsWordSequence(definitionWords(definition), searchWords) {
+			seen[entry.ID] = true
+			partial = append(partial, entry.Copy())
 		}
 	}
-	spans = spans[:ri]
 
-	if len(spans) == 0 && len(f.Terms) > 0 {
-		return nil
+	if len(exact) > 0 {
+		return exact
 	}
 
-	translationAdjacent := make(map[string][][]int, len(example.Translations))
-	translationSpans := make(map[string][][]int, len(example.Translations))
-	ids := make([]int, 0, 8)
-	revIDs := make([]int, 0, 8)
+	return partial
+}
 
-	nonAdjacentMap := map[int]bool{}
-	if f.NoAdjacent {
-		for _, span := range spans {
-			for _, i := range span {
-				nonAdjacentMap[i] = true
-			}
+func isDefinitionSenseSeparator(r rune) bool {
+	return r == ',' || r == ';' || r == '/'
+}
+
+// normalizeDefinitionSense lowercases the sense and removes parenthesized remarks, surrounding punctuation and
+// the infinitive's "to", so that `to want` and `want (something)` are the same.
+func normalizeDefinitionSense(sense string) string {
+	sb := strings.Builder{}
+	depth := 0
+	for _, ch := range strings.ToLower(sense) {
+		switch {
+		case ch == '(':
+			depth += 1
+		case ch == ')' && depth > 0:
+			depth -= 1
+		case depth == 0:
+			sb.WriteRune(ch)
 		}
 	}
 
-	for lang, translated := range example.Translations {
-		translationSpans[lang] = make([][]int, len(spans))
-		translationAdjacent[lang] = make([][]int, len(spans))
+	words := strings.Fields(strings.TrimFunc(sb.String(), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+	if len(words) > 1 && words[0] == "to" {
+		words = words[1:]
+	}
+
+	return strings.Join(words, " ")
+}
 
-		isEN := lang == "en" // TODO: Use context to limit translations
+func definitionWords(str string) []string {
+	return strings.FieldsFunc(strings.ToLower(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
 
-		if len(translated) == 0 {
-			continue
+func containsWordSequence(words, sequence []string) bool {
+	for i := 0; i+len(sequence) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(sequence)], sequence) {
+			return true
 		}
+	}
 
-		for i, span := range spans {
-			translationSpans[lang][i] = []int{}
-			translationAdjacent[lang][i] = []int{}
+	return false
+}
 
-			// Find the IDs to select with.
-			ids = ids[:0]
-			for key := range seen {
-				delete(seen, key)
-			}
-			for _, index := range span {
-				part := example.Text[index]
-				for _, id := range part.IDs {
-					if seen[id] {
-						continue
-					}
-					ids = append(ids, id)
-					seen[id] = true
-				}
-			}
+// NeedFullList returns true if there is a branch of the filter that does not require any
+// specific dictionary entry, and the storage must go through every example.
+func (f *Filter) NeedFullList() bool {
+	if f.Root == nil {
+		return true
+	}
 
-			// Select with the translation and add any unseen IDs for the adjacent list.
-			revIDs = revIDs[:0]
-			for key := range seen {
-				delete(seen, key)
+	return f.nodeNeedsFullList(f.Root)
+}
+
+func (f *Filter) nodeNeedsFullList(node *FilterNode) bool {
+	switch node.Operator {
+	case "":
+		term := f.Terms[node.Term]
+		return term.IsText || term.Not || term.Word == "*"
+	case FTONot:
+		return true
+	case FTOOr:
+		for i := range node.Children {
+			if f.nodeNeedsFullList(&node.Children[i]) {
+				return true
 			}
-			for j, part := range example.Translations[lang] {
-				if part.HasAnyID(ids) {
-					for _, id := range part.IDs {
-						if seen[id] {
-							continue
-						}
-						revIDs = append(revIDs, id)
-						seen[id] = true
-					}
+		}
 
-					translationSpans[lang][i] = append(translationSpans[lang][i], j)
-				}
+		return false
+	default:
+		for i := range node.Children {
+			if !f.nodeNeedsFullList(&node.Children[i]) {
+				return false
 			}
+		}
 
-			for j, part := range example.Text {
-				isInSpan := false
-				for _, index := range span {
-					if j == index {
-						isInSpan = true
-						break
-					}
-				}
+		return true
+	}
+}
 
-				if !isInSpan && part.HasAnyID(revIDs) {
-					if isEN && f.NoAdjacent && !nonAdjacentMap[j] {
-						return nil
-					}
+// WordLookupStrategy lists the alternative ways of finding the examples this filter can match. Every
+// alternative is a list of sets of dictionary entries, and an example must have at least one entry
+// from each of the sets in one of the alternatives. An alternative without any sets means that the
+// full list is needed.
+func (f *Filter) WordLookupStrategy(candidates map[int][]DictionaryEntry) [][][]DictionaryEntry {
+	if f.Root == nil {
+		return [][][]DictionaryEntry{{}}
+	}
 
-					translationAdjacent[lang][i] = append(translationAdjacent[lang][i], j)
+	return f.nodeLookupStrategy(f.Root, candidates)
+}
+
+func (f *Filter) nodeLookupStrategy(node *FilterNode, candidates map[int][]DictionaryEntry) [][][]DictionaryEntry {
+	switch node.Operator {
+	case "":
+		term := f.Terms[node.Term]
+		if term.IsText || term.Not || term.Word == "*" {
+			return [][][]DictionaryEntry{{}}
+		}
+
+		return [][][]DictionaryEntry{{candidates[node.Term]}}
+	case FTONot:
+		return [][][]DictionaryEntry{{}}
+	case FTOOr:
+		res := make([][][]DictionaryEntry, 0, len(node.Children))
+		for i := range node.Children {
+			res = append(res, f.nodeLookupStrategy(&node.Children[i], candidates)...)
+		}
+
+		return res
+	default:
+		// All children must match, so every combination of their alternatives is needed.
+		res := [][][]DictionaryEntry{{}}
+		for i := range node.Children {
+			childRes := f.nodeLookupStrategy(&node.Children[i], candidates)
+			combined := make([][][]DictionaryEntry, 0, len(res)*len(childRes))
+			for _, curr := range res {
+				for _, alternative := range childRes {
+					combined = append(combined, append(curr[:len(curr):len(curr)], alternative...))
 				}
 			}
+
+			res = combined
 		}
+
+		return res
 	}
+}
 
-	return &FilterMatch{
-		Example:             example,
-		Spans:               spans,
-		TranslationAdjacent: translationAdjacent,
-		TranslationSpans:    translationSpans,
-		WordMap:             example.Text.WordMap(),
+type FilterTerm struct {
+	Word        string       `json:"word" yaml:"word"`
+	Constraints WordFilter   `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+	Roles       []FilterRole `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Not         bool         `json:"not,omitempty" yaml:"not,omitempty"`
+	IsText      bool         `json:"isText,omitempty" yaml:"is_text,omitempty"`
+	IsRegex     bool         `json:"isRegex,omitempty" yaml:"is_regex,omitempty"`
+	Fold        bool         `json:"fold,omitempty" yaml:"fold,omitempty"`
+	// DefinitionLang is set for terms like `en:"to want"`, where the Word is searched for in the definitions
+	// in that language instead of being looked up as a Na'vi word.
+	DefinitionLang string `json:"definitionLang,omitempty" yaml:"definition_lang,omitempty"`
+
+	// regexp is the compiled regular expression of IsRegex terms. It is set by the parser and Validate.
+	regexp *regexp.Regexp
+}
+
+// FilterRole requires the word to be linked by one of the example's annotations. If Word is empty, the
+// word itself must be linked as the role, like `*:@dative`. Otherwise, it must be in an annotation
+// that links another word matching Word and Constraints as the role, like `taron:@patient=*:n.`.
+type FilterRole struct {
+	Role        string     `json:"role" yaml:"role"`
+	Word        string     `json:"word,omitempty" yaml:"word,omitempty"`
+	Constraints WordFilter `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+}
+
+func (r FilterRole) String() string {
+	if r.Word == "" {
+		return "@" + r.Role
 	}
+
+	if len(r.Constraints) > 0 {
+		return "@" + r.Role + "=" + r.Word + ":" + r.Constraints.String()
+	}
+
+	return "@" + r.Role + "=" + r.Word
 }
 
-// lookupWords get all combinations of DictionaryEntries that are matched by the general criteria.
-// It will not check prefixes, infixes, suffixes and lenitions here. It will return an error if the
-// dictionary failed.
-func (f *Filter) lookupWords(ctx context.Context, dictionary Dictionary) ([]map[int]DictionaryEntry, error) {
-	maps := make([]map[int]DictionaryEntry, 0, len(f.Terms)*2)
-	maps = append(maps, map[int]DictionaryEntry{})
+// check checks the role for the word with the ID, and gives the IDs of the linked words that matched.
+func (r FilterRole) check(example *Example, id int) ([]int, bool) {
+	var linked []int
+	for _, annotation := range example.Annotations {
+		if r.Word == "" {
+			if slices.Contains(annotation.Links[r.Role], id) {
+				return nil, true
+			}
 
-	for i, term := range f.Terms {
-		if term.Word == "*" || term.IsText {
 			continue
 		}
 
-		entries, err := dictionary.Lookup(ctx, term.Word, true)
-		if err != nil {
-			return nil, err
-		}
-		filteredEntries := entries[:0]
-		for _, entry := range entries {
-			if term.Constraints.Check(&entry, false) {
-				filteredEntries = append(filteredEntries, entry)
+		inAnnotation := false
+		for _, ids := range annotation.Links {
+			if slices.Contains(ids, id) {
+				inAnnotation = true
+				break
 			}
 		}
-
-		if len(filteredEntries) == 0 {
-			return nil, FilterParseError{
-				Term:    i,
-				Code:    "no_matched_entries",
-				Message: fmt.Sprintf("No dictionary entry matched word or constraints of %+v", term.Word),
-			}
+		if !inAnnotation {
+			continue
 		}
 
-		// Add first found entry to all maps
-		for _, m := range maps {
-			m[i] = filteredEntries[0]
-		}
+		for _, linkedID := range annotation.Links[r.Role] {
+			if linkedID == id || slices.Contains(linked, linkedID) {
+				continue
+			}
 
-		// For every subsequent entry, create a copy of the maps with them.
-		// So that if there's 2 words for entry 0 and 3 for 1, it'll be:
-		// 6 maps with all combinations.
-		existingMaps := maps[:]
-		for _, entry := range filteredEntries[1:] {
-			for _, m := range existingMaps {
-				m2 := make(map[int]DictionaryEntry)
-				for key, value := range m {
-					m2[key] = value.Copy()
+			for _, word := range example.Words[linkedID] {
+				if matchWordPattern(r.Word, strings.TrimSuffix(word.Word, "+")) && r.Constraints.Check(&word, true) {
+					linked = append(linked, linkedID)
+					break
 				}
-				m2[i] = entry
-
-				maps = append(maps, m2)
 			}
 		}
 	}
 
-	return maps, nil
+	return linked, len(linked) > 0
 }
 
-func (f *Filter) NeedFullList() bool {
-	answer := true
-	for _, term := range f.Terms {
-		if term.Operator == FTOOr && answer {
-			return answer
-		}
-
-		if !term.IsText && term.Word != "*" {
-			answer = false
-		}
-	}
-
-	return answer
+// IsPattern returns true if the word has wildcards, like `tì*` or `*yu`. A lone `*` is not a pattern
+// since it matches any word without looking them up in the dictionary.
+func (t FilterTerm) IsPattern() bool {
+	return !t.IsText && t.DefinitionLang == "" && t.Word != "*" && strings.ContainsAny(t.Word, "*?")
 }
 
-func (f *Filter) WordLookupStrategy(resolved map[int]DictionaryEntry) [][]DictionaryEntry {
-	var curr []DictionaryEntry
-	var res [][]DictionaryEntry
-
-	for i, term := range f.Terms {
-		if term.Operator == FTOOr {
-			res = append(res, curr)
-			curr = []DictionaryEntry{}
-		}
+func (t FilterTerm) String() string {
+	sb := strings.Builder{}
+	if t.Not {
+		sb.WriteString("!")
+	}
 
-		curr = append(curr, resolved[i])
+	if t.IsRegex {
+		sb.WriteByte('/')
+		sb.WriteString(t.Word)
+		sb.WriteByte('/')
+	} else if t.IsText {
+		sb.WriteByte('"')
+		sb.WriteString(t.Word)
+		sb.WriteByte('"')
+	} else if t.DefinitionLang != "" {
+		sb.WriteString(t.DefinitionLang)
+		sb.WriteString(":\"")
+		sb.WriteString(t.Word)
+		sb.WriteByte('"')
+	} else {
+		sb.WriteString(t.Word)
 	}
 
-	res = append(res, curr)
-	return res
-}
+	for _, constraint := range t.Constraints {
+		sb.WriteByte(':')
+		sb.WriteString(constraint)
+	}
+	if t.Fold {
+		sb.WriteString(":fold")
+	}
+	for _, role := range t.Roles {
+		sb.WriteByte(':')
+		sb.WriteString(role.String())
+	}
 
-type FilterTerm struct {
-	Operator    string
-	Word        string
-	Constraints WordFilter
-	Not         bool
-	IsText      bool
+	return sb.String()
 }
 
 var operatorAliases = [][2]string{
@@ -707,6 +1323,42 @@ var operatorAliases = [][2]string{
 	{"WITH ATTACHED", FTOEnclitic},
 	{"SURROUNDED BY", FTOASurroundedBy},
 	{"SURROUNDING", FTOSurrounding},
+	{FTOWithinAfterAcross, FTOWithinAfterAcross},
+	{FTOWithinAfter, FTOWithinAfter},
+	{FTOWithinAcross, FTOWithinAcross},
+	{FTOWithin, FTOWithin},
+	{"FOLLOWED WITHIN ACROSS", FTOWithinAfterAcross},
+	{"FOLLOWED WITHIN", FTOWithinAfter},
+	{"WITHIN ACROSS", FTOWithinAcross},
+	{"WITHIN", FTOWithin},
+}
+
+func isFilterOperator(op string) bool {
+	for _, alias := range operatorAliases {
+		if alias[1] == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDistanceOperator returns true for the proximity operators, which are followed by the distance.
+func isDistanceOperator(op string) bool {
+	return op == FTOWithin || op == FTOWithinAcross || op == FTOWithinAfter || op == FTOWithinAfterAcross
+}
+
+func filterOperatorPrecedence(op string) int {
+	switch op {
+	case FTOOr:
+		return 1
+	case FTOAnd:
+		return 2
+	case "", FTONot:
+		return 4
+	default:
+		return 3
+	}
 }
 
 const FTOSurrounding = ">+<"
@@ -715,10 +1367,15 @@ const FTOBefore = "+>>"
 const FTOBeforeAcross = "+.>>"
 const FTOFollowedBy = "+>"
 const FTOFollowedByAcross = "+.>"
+const FTOWithin = "~"
+const FTOWithinAcross = "~."
+const FTOWithinAfter = "~>"
+const FTOWithinAfterAcross = "~.>"
 const FTOEnclitic = "<-"
 const FTONextTo = "+"
 const FTOAnd = "&&"
 const FTOOr = "||"
+const FTONot = "!"
 
 func ParseWordFilter(str string) WordFilter {
 	if str == "" {
@@ -998,10 +1655,70 @@ func (mwf MultiWordFilter) Check(e *DictionaryEntry, checkModifiers bool) bool {
 	return false
 }
 
+// FilterDateRange limits the date of the example's source. The bounds can be partial dates like 2014
+// or 2014-06, and the source date is then only compared up to the same precision. An empty bound is
+// open, and the exclusive flags are set when the bound itself should not be included.
+type FilterDateRange struct {
+	From          string `json:"from,omitempty" yaml:"from,omitempty"`
+	To            string `json:"to,omitempty" yaml:"to,omitempty"`
+	FromExclusive bool   `json:"fromExclusive,omitempty" yaml:"from_exclusive,omitempty"`
+	ToExclusive   bool   `json:"toExclusive,omitempty" yaml:"to_exclusive,omitempty"`
+}
+
+func (r FilterDateRange) Check(date string) bool {
+	if date == "" {
+		return false
+	}
+
+	if r.From != "" {
+		cmp := strings.Compare(date[:min(len(date), len(r.From))], r.From)
+		if cmp < 0 || (cmp == 0 && r.FromExclusive) {
+			return false
+		}
+	}
+
+	if r.To != "" {
+		cmp := strings.Compare(date[:min(len(date), len(r.To))], r.To)
+		if cmp > 0 || (cmp == 0 && r.ToExclusive) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r FilterDateRange) String() string {
+	switch {
+	case r.From != "" && r.From == r.To && !r.FromExclusive && !r.ToExclusive:
+		return r.From
+	case r.To == "" && r.FromExclusive:
+		return ">" + r.From
+	case r.To == "":
+		return ">=" + r.From
+	case r.From == "" && r.ToExclusive:
+		return "<" + r.To
+	case r.From == "":
+		return "<=" + r.To
+	default:
+		return r.From + ".." + r.To
+	}
+}
+
+// FilterParseError is returned when a filter could not be parsed or its words could not be looked up.
+// Start and End are byte offsets into the query, while RuneStart and RuneEnd count characters instead.
+// Token is the part of the query they point to, and it is empty if the error is at the end of it.
 type FilterParseError struct {
-	Term    int    `json:"term"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Term      int    `json:"term"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Token     string `json:"token"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	RuneStart int    `json:"runeStart"`
+	RuneEnd   int    `json:"runeEnd"`
+
+	// Suggestions are the dictionary words that are spelled similarly to a term that did not match any entry.
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 func (e FilterParseError) Error() string {
@@ -1011,6 +1728,8 @@ func (e FilterParseError) Error() string {
 type FilterMatch struct {
 	Example
 
+	// Entries are the dictionary entries of the terms that matched, in the order of the terms.
+	Entries             []DictionaryEntry  `json:"entries,omitempty"`
 	Spans               [][]int            `json:"spans"`
 	TranslationAdjacent map[string][][]int `json:"translatedAdjacent"`
 	TranslationSpans    map[string][][]int `json:"translatedSpans"`
@@ -1100,6 +1819,54 @@ type FilterMatchCompactChunk struct {
 	IndirectMatch []int `json:"im,omitempty"`
 }
 
+// matchWordPattern matches a word against a case-insensitive glob pattern, where `*` is any number
+// of letters and `?` is exactly one.
+func matchWordPattern(pattern, word string) bool {
+	p := []rune(strings.ToLower(pattern))
+	w := []rune(strings.ToLower(word))
+
+	pi, wi := 0, 0
+	starP, starW := -1, 0
+	for wi < len(w) {
+		if pi < len(p) && (p[pi] == '?' || p[pi] == w[wi]) {
+			pi += 1
+			wi += 1
+		} else if pi < len(p) && p[pi] == '*' {
+			starP = pi
+			starW = wi
+			pi += 1
+		} else if starP != -1 {
+			pi = starP + 1
+			starW += 1
+			wi = starW
+		} else {
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi += 1
+	}
+
+	return pi == len(p)
+}
+
+// compileFilterRegexp compiles a regular expression term to run against the normalized raw text with
+// Sentence.SearchRawRegexp.
+func compileFilterRegexp(pattern string, fold bool) (*regexp.Regexp, error) {
+	if fold {
+		pattern = strings.Map(func(ch rune) rune {
+			if folded, ok := rawFoldTable[unicode.ToLower(ch)]; ok {
+				return folded
+			}
+
+			return ch
+		}, pattern)
+	}
+
+	return regexp.Compile("(?i)" + translateRawRegexp(pattern))
+}
+
 func inStringList(list []string, value string, aliases map[string]string) bool {
 	if alias, ok := aliases[value]; ok {
 		value = alias
@@ -0,0 +1,132 @@
+package sarfya
+
+import (
+	"context"
+	"strings"
+)
+
+// ExplainExample tells why the example does or does not match the filter. Unlike CheckExample, it
+// evaluates every node of the expression tree on its own, so it should only be used for troubleshooting
+// queries.
+func (f *Filter) ExplainExample(example Example, candidates map[int][]DictionaryEntry) *FilterExplanation {
+	res := &FilterExplanation{}
+
+	if reason := f.sourceMismatch(example.Source); reason != "" {
+		res.Reason = reason
+		return res
+	}
+	if !f.CheckFlags(&example) {
+		res.Reason = "The example's flags do not match the flag: terms."
+		return res
+	}
+
+	if f.Root == nil {
+		res.Matched = true
+		return res
+	}
+
+	res.Nodes = make([]FilterNodeExplanation, 0, len(f.Terms)*2)
+	f.explainNode(&res.Nodes, f.Root, 0, &example, candidates)
+	res.Matched = res.Nodes[0].Passed
+
+	if res.Matched && f.NoAdjacent && hasAdjacentWords(&example, res.Nodes[0].Spans) {
+		res.Matched = false
+		res.Reason = "The translation links the matched words to other words, which opt:noadjacent does not allow."
+	}
+
+	return res
+}
+
+func (f *Filter) explainNode(res *[]FilterNodeExplanation, node *FilterNode, depth int, example *Example, candidates map[int][]DictionaryEntry) {
+	sb := strings.Builder{}
+	f.writeNode(&sb, node, false)
+
+	explanation := FilterNodeExplanation{
+		Expression: sb.String(),
+		Operator:   node.Operator,
+		Term:       -1,
+		Depth:      depth,
+	}
+	if node.Operator == "" {
+		explanation.Term = node.Term
+	}
+
+	spans, passed := f.evaluateNode(context.Background(), node, example, candidates)
+	explanation.Passed = passed
+	for _, span := range spans {
+		explanation.Spans = append(explanation.Spans, append(span.indices[:0:0], span.indices...))
+	}
+
+	index := len(*res)
+	*res = append(*res, explanation)
+
+	failedChildren := 0
+	for i := range node.Children {
+		childIndex := len(*res)
+		f.explainNode(res, &node.Children[i], depth+1, example, candidates)
+		if !(*res)[childIndex].Passed {
+			failedChildren += 1
+		}
+	}
+
+	if !passed {
+		(*res)[index].Reason = f.failureReason(node, failedChildren, candidates)
+	}
+}
+
+func (f *Filter) failureReason(node *FilterNode, failedChildren int, candidates map[int][]DictionaryEntry) string {
+	switch node.Operator {
+	case "":
+		term := f.Terms[node.Term]
+		switch {
+		case term.IsRegex:
+			return "The regular expression did not match the text."
+		case term.IsText:
+			return "The text was not found."
+		case term.Not:
+			return "Every word in the example matched the negated term."
+		case term.Word != "*" && len(candidates[node.Term]) == 0:
+			return "The term has no dictionary entries to match."
+		case term.Word != "*":
+			return "No word in the example is one of the term's dictionary entries with the constraints and roles."
+		default:
+			return "No word in the example matched the constraints and roles."
+		}
+	case FTONot:
+		return "The excluded expression matched."
+	case FTOOr:
+		return "None of the alternatives matched."
+	case FTOAnd:
+		if failedChildren > 0 {
+			return "Not all the parts matched."
+		}
+
+		return "The parts only matched the same words."
+	default:
+		if failedChildren > 0 {
+			return "One of the sides did not match."
+		}
+
+		return "The sides matched, but not in the positions required by the operator."
+	}
+}
+
+// FilterExplanation is the result of Filter.ExplainExample.
+type FilterExplanation struct {
+	// Matched is whether CheckExample would return a match.
+	Matched bool `json:"matched"`
+	// Reason is set if the example was rejected outside the expression, like by src:, flag: or opt:noadjacent.
+	Reason string `json:"reason,omitempty"`
+	// Nodes are all the nodes of the expression tree in pre-order, starting with the root.
+	Nodes []FilterNodeExplanation `json:"nodes,omitempty"`
+}
+
+type FilterNodeExplanation struct {
+	Expression string  `json:"expression"`
+	Operator   string  `json:"op,omitempty"`
+	Term       int     `json:"term"`
+	Depth      int     `json:"depth"`
+	Passed     bool    `json:"passed"`
+	Spans      [][]int `json:"spans,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+}
@@ -0,0 +1,773 @@
+package sarfya
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseFilterString parses the query into a Filter without looking up any words. Filter.String will give
+// back a canonical form of the query that parses into an identical Filter. The grammar is, from
+// the lowest to the highest precedence:
+//
+//	or         = and { "||" and }
+//	and        = positional { "&&" positional }
+//	positional = unary { positional-operator unary }
+//	           | unary { proximity-operator distance unary }
+//	unary      = "!" "(" or ")" | "!" term | exclusion unary | "(" or ")" | term
+//	exclusion  = "-" | "NOT"
+//
+// A "!" in front of a term inverts the word check, so `!fpom` matches any word that is not fpom. A "!"
+// in front of a parenthesized group, or a "-" or "NOT" in front of anything, will instead reject any
+// example that it matches, so `-fpom` matches the examples without fpom. The canonical form of an
+// exclusion is `!(fpom)`.
+//
+// A term like `en:"to want"` searches the definitions in that language. ParseFilter only reads it like that
+// if the dictionary has definitions in the language, and otherwise `en` is the word and the rest constraints.
+//
+// A regular expression term like `/uv(a|o)n/` is matched against the text of the example with everything
+// but letters and spaces left out, in lowercase. Since only letters are left, `\w` and `\W` are letters and
+// non-letters, and `\b` and `\B` are at the edges of words and within them, also next to letters like ä and
+// ì. The `^` and `$` are the start and end of the whole text. These assertions are checked after the rest of
+// the expression has matched, so an alternative that fails them does not make it try the next one, like
+// `uvan\b|uvansi` does not find `uvansi`.
+func ParseFilterString(str string) (*Filter, error) {
+	filter, _, err := parseFilter(str, nil)
+	return filter, err
+}
+
+// parseFilter parses the filter, and also gives the token of every term so that errors found
+// after parsing can point to them. If isDefinitionLang is not nil, a term like `en:"to want"` is only
+// a definition term if it returns true for the language.
+func parseFilter(str string, isDefinitionLang func(lang string) bool) (*Filter, []filterToken, error) {
+	tokens, err := tokenizeFilter(str)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &filterParser{
+		str:    str,
+		tokens: tokens,
+		filter: &Filter{},
+
+		isDefinitionLang: isDefinitionLang,
+	}
+
+	if len(p.tokens) == 0 {
+		return p.filter, nil, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		if p.tokens[p.pos].kind == ftkClose {
+			return nil, nil, p.error("unbalanced_parenthesis", "A closing parenthesis does not have an opening one.")
+		}
+
+		return nil, nil, p.error("missing_operator", "Two terms or groups must be separated by an operator.")
+	}
+
+	p.filter.Root = root
+	return p.filter, p.termTokens, nil
+}
+
+type filterParser struct {
+	str    string
+	tokens []filterToken
+	pos    int
+	depth  int
+	filter *Filter
+
+	termTokens  []filterToken
+	globalCount int
+	lastGlobal  filterToken
+
+	isDefinitionLang func(lang string) bool
+}
+
+func (p *filterParser) parseOr() (*FilterNode, error) {
+	globalCount := p.globalCount
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.nextIsOperator(FTOOr) {
+		return node, nil
+	}
+
+	orNode := &FilterNode{Operator: FTOOr}
+	for {
+		if node == nil {
+			return nil, p.errorAt(p.lastGlobal, "misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be used as an alternative.")
+		}
+		if node.Operator == FTOOr {
+			orNode.Children = append(orNode.Children, node.Children...)
+		} else {
+			orNode.Children = append(orNode.Children, *node)
+		}
+
+		if !p.nextIsOperator(FTOOr) {
+			break
+		}
+		p.pos += 1
+
+		node, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.globalCount != globalCount {
+		return nil, p.errorAt(p.lastGlobal, "misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be used as an alternative.")
+	}
+
+	return orNode, nil
+}
+
+func (p *filterParser) parseAnd() (*FilterNode, error) {
+	andNode := &FilterNode{Operator: FTOAnd}
+	for {
+		node, err := p.parsePositional()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil && node.Operator == FTOAnd {
+			andNode.Children = append(andNode.Children, node.Children...)
+		} else if node != nil {
+			andNode.Children = append(andNode.Children, *node)
+		}
+
+		if !p.nextIsOperator(FTOAnd) {
+			break
+		}
+		p.pos += 1
+	}
+
+	switch len(andNode.Children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &andNode.Children[0], nil
+	default:
+		return andNode, nil
+	}
+}
+
+func (p *filterParser) parsePositional() (*FilterNode, error) {
+	start := p.pos
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind == ftkOperator && p.tokens[p.pos].op != FTOAnd && p.tokens[p.pos].op != FTOOr {
+		operator := p.tokens[p.pos].op
+		distance := p.tokens[p.pos].distance
+		if node == nil {
+			return nil, p.errorAt(p.lastGlobal, "misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be used with positional operators.")
+		}
+		if node.Operator == FTONot {
+			return nil, p.errorAt(p.tokens[start], "misplaced_exclusion", "An excluded expression has no position, so it cannot be used with positional operators.")
+		}
+		p.pos += 1
+
+		start = p.pos
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			return nil, p.errorAt(p.lastGlobal, "misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be used with positional operators.")
+		}
+		if right.Operator == FTONot {
+			return nil, p.errorAt(p.tokens[start], "misplaced_exclusion", "An excluded expression has no position, so it cannot be used with positional operators.")
+		}
+
+		node = &FilterNode{Operator: operator, Distance: distance, Children: []FilterNode{*node, *right}}
+	}
+
+	return node, nil
+}
+
+func (p *filterParser) parseUnary() (*FilterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.error("empty_query_term", "A filter term cannot be empty.")
+	}
+
+	token := p.tokens[p.pos]
+	switch token.kind {
+	case ftkNot:
+		p.pos += 1
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == ftkOpen {
+			node, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			if node == nil {
+				return nil, p.errorAt(p.lastGlobal, "misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be negated.")
+			}
+
+			return &FilterNode{Operator: FTONot, Children: []FilterNode{*node}}, nil
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != ftkTerm {
+			return nil, p.error("empty_query_term", "A filter term cannot be empty.")
+		}
+
+		return p.parseTerm(true)
+	case ftkExclude:
+		p.pos += 1
+		if p.pos >= len(p.tokens) {
+			return nil, p.error("empty_query_term", "A filter term cannot be empty.")
+		}
+
+		// The global terms cannot be excluded, and they are only rejected inside groups.
+		p.depth += 1
+		node, err := p.parseUnary()
+		p.depth -= 1
+		if err != nil {
+			return nil, err
+		}
+
+		return &FilterNode{Operator: FTONot, Children: []FilterNode{*node}}, nil
+	case ftkOpen:
+		return p.parseGroup()
+	case ftkTerm:
+		return p.parseTerm(false)
+	case ftkClose:
+		return nil, p.error("empty_query_term", "A filter term cannot be empty.")
+	default:
+		return nil, p.error("empty_query_term", "A filter term cannot be empty.")
+	}
+}
+
+func (p *filterParser) parseGroup() (*FilterNode, error) {
+	openToken := p.tokens[p.pos]
+	p.pos += 1
+	p.depth += 1
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != ftkClose {
+		return nil, p.errorAt(openToken, "unbalanced_parenthesis", "An opening parenthesis is missing its closing one.")
+	}
+
+	p.pos += 1
+	p.depth -= 1
+
+	return node, nil
+}
+
+func (p *filterParser) parseTerm(not bool) (*FilterNode, error) {
+	filter := p.filter
+	termString := p.tokens[p.pos].text
+	i := len(filter.Terms)
+
+	if isGlobalFilterTerm(termString) {
+		if not || p.depth > 0 {
+			return nil, p.error("misplaced_global_term", "The src:, date:, author:, flag: and opt: terms cannot be negated or grouped.")
+		}
+		p.globalCount += 1
+		p.lastGlobal = p.tokens[p.pos]
+
+		if strings.HasPrefix(termString, "src:") {
+			sourceID := termString[4:]
+			filter.SourceID = &sourceID
+			p.pos += 1
+			return nil, nil
+		}
+
+		if strings.HasPrefix(termString, "date:") {
+			dateRange, ok := parseFilterDateRange(termString[5:])
+			if !ok {
+				return nil, p.error("date_not_understood", "The date must be like 2014, 2014-06 or 2014-06-28, optionally with <, <=, >, >= or a range like 2012..2014.")
+			}
+
+			filter.Dates = append(filter.Dates, dateRange)
+			p.pos += 1
+			return nil, nil
+		}
+
+		if strings.HasPrefix(termString, "author:") {
+			author := strings.TrimSpace(termString[7:])
+			if strings.HasPrefix(author, "\"") && strings.HasSuffix(author, "\"") && len(author) >= 2 {
+				author = author[1 : len(author)-1]
+			}
+			if author == "" {
+				return nil, p.error("empty_author", "The author cannot be empty.")
+			}
+			if strings.ContainsRune(author, '"') {
+				return nil, p.error("author_not_understood", "The author cannot contain quotes.")
+			}
+
+			filter.Authors = append(filter.Authors, author)
+			p.pos += 1
+			return nil, nil
+		}
+
+		if strings.HasPrefix(termString, "flag:") {
+			flag := ExampleFlag(termString[5:])
+			if strings.HasPrefix(string(flag), "-") {
+				if !flag[1:].Valid() {
+					return nil, p.error("flag_not_understood", "The flag you specified is not found.")
+				}
+			} else {
+				if !flag.Valid() {
+					return nil, p.error("flag_not_understood", "The flag you specified is not found.")
+				}
+			}
+
+			filter.Flags = append(filter.Flags, flag)
+			p.pos += 1
+			return nil, nil
+		}
+
+		if termString == "opt:noadjacent" || termString == "opt:no_adjacent" || termString == "option:no_adjacent" {
+			filter.NoAdjacent = true
+			p.pos += 1
+			return nil, nil
+		}
+
+		return nil, p.error("option_not_understood", "The option you specified is not found.")
+	}
+
+	if i == 8 {
+		return nil, p.error("too_many_terms", "A filter cannot have more than 8 terms.")
+	}
+
+	var split []string
+	var re *regexp.Regexp
+	fold := false
+	isText := strings.HasPrefix(termString, "\"")
+	isRegex := strings.HasPrefix(termString, "/")
+	definitionLang, definitionTerm, isDefinition := cutDefinitionTerm(termString)
+	if isDefinition && p.isDefinitionLang != nil && !p.isDefinitionLang(definitionLang) {
+		definitionLang, definitionTerm, isDefinition = "", "", false
+	}
+	if isText || isRegex {
+		endIndex := strings.LastIndex(termString, termString[:1])
+		split = []string{termString[1:endIndex]}
+		if rest := termString[endIndex+1:]; rest != "" {
+			for _, option := range strings.Split(strings.TrimPrefix(rest, ":"), ":") {
+				if option == "fold" && !fold {
+					fold = true
+				} else {
+					split = append(split, option)
+				}
+			}
+		}
+
+		if len(split) > 2 {
+			return nil, p.error("text_filter_constraints", "A text filter term can only have a language and the fold option.")
+		}
+
+		if isRegex {
+			if split[0] == "" {
+				return nil, p.error("empty_query_term", "A regular expression cannot be empty.")
+			}
+			var err error
+			re, err = compileFilterRegexp(split[0], fold)
+			if err != nil {
+				return nil, p.error("invalid_regex", fmt.Sprintf("The regular expression is not valid: %s.", err))
+			}
+
+			isText = true
+		}
+	} else if isDefinition {
+		endIndex := strings.IndexByte(definitionTerm[1:], '"') + 1
+		split = []string{strings.TrimSpace(definitionTerm[1:endIndex])}
+		if split[0] == "" {
+			return nil, p.error("empty_query_term", "A definition to search for cannot be empty.")
+		}
+
+		if rest := definitionTerm[endIndex+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return nil, p.error("definition_not_understood", "A definition term must be like en:\"to want\", optionally followed by constraints.")
+			}
+
+			split = append(split, strings.SplitN(rest[1:], ":", 9)...)
+		}
+		if len(split) == 10 {
+			return nil, p.error("too_many_constraints", "A filter term cannot have more than 8 constraints.")
+		}
+	} else {
+		split = strings.SplitN(termString, ":", 10)
+		if len(split) == 10 {
+			return nil, p.error("too_many_constraints", "A filter term cannot have more than 8 constraints.")
+		}
+	}
+
+	// `role:agent` is a shorthand for `*:@agent`.
+	if !isText && !isDefinition && split[0] == "role" && len(split) > 1 {
+		split = append([]string{"*", "@" + split[1]}, split[2:]...)
+	}
+
+	var constraints WordFilter
+	var roles []FilterRole
+	for j := 1; j < len(split); j++ {
+		constraint := split[j]
+		if isText || !strings.HasPrefix(constraint, "@") {
+			constraints = append(constraints, constraint)
+			continue
+		}
+
+		// Everything after `@role=` belongs to the linked word, like in `taron:@patient=*:n.`.
+		role, linkedWord, hasLinkedWord := strings.Cut(constraint[1:], "=")
+		if !slices.Contains(annotationLinkKeys, role) {
+			return nil, p.error("role_not_understood", fmt.Sprintf("The role must be one of: %s.", strings.Join(annotationLinkKeys, ", ")))
+		}
+
+		if hasLinkedWord {
+			if linkedWord == "" {
+				return nil, p.error("empty_query_term", "A linked word cannot be empty.")
+			}
+
+			roles = append(roles, FilterRole{Role: role, Word: linkedWord, Constraints: ParseWordFilter(strings.Join(split[j+1:], ":"))})
+			break
+		}
+
+		roles = append(roles, FilterRole{Role: role})
+	}
+
+	filter.Terms = append(filter.Terms, FilterTerm{
+		Word:        split[0],
+		Constraints: constraints,
+		Roles:       roles,
+		Not:         not,
+		IsText:      isText,
+		IsRegex:     isRegex,
+		Fold:        fold,
+
+		DefinitionLang: definitionLang,
+
+		regexp: re,
+	})
+
+	p.termTokens = append(p.termTokens, p.tokens[p.pos])
+	p.pos += 1
+	return &FilterNode{Term: i}, nil
+}
+
+// cutDefinitionTerm splits a term like `en:"to want":vtr.` into the language and the quoted rest. The language
+// must be a lowercase code like `en` or `pt_br`, and ParseFilter also requires the dictionary to have definitions
+// in it, so that a term like `role:"x"` is not mistaken for one.
+func cutDefinitionTerm(termString string) (lang, rest string, ok bool) {
+	lang, rest, ok = strings.Cut(termString, ":")
+	if !ok || !strings.HasPrefix(rest, "\"") || len(lang) < 2 || len(lang) > 5 {
+		return "", "", false
+	}
+	for _, ch := range lang {
+		if (ch < 'a' || ch > 'z') && ch != '_' {
+			return "", "", false
+		}
+	}
+	if strings.IndexByte(rest[1:], '"') == -1 {
+		return "", "", false
+	}
+
+	return lang, rest, true
+}
+
+// isGlobalFilterTerm returns true for the terms that apply to the whole example rather than words in it.
+func isGlobalFilterTerm(termString string) bool {
+	for _, prefix := range []string{"src:", "date:", "author:", "flag:", "opt:", "option:"} {
+		if strings.HasPrefix(termString, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseFilterDateRange parses the value of a date: term.
+func parseFilterDateRange(str string) (FilterDateRange, bool) {
+	res := FilterDateRange{}
+
+	if from, to, found := strings.Cut(str, ".."); found {
+		res.From = from
+		res.To = to
+	} else if value, found := strings.CutPrefix(str, ">="); found {
+		res.From = value
+	} else if value, found := strings.CutPrefix(str, "<="); found {
+		res.To = value
+	} else if value, found := strings.CutPrefix(str, ">"); found {
+		res.From = value
+		res.FromExclusive = true
+	} else if value, found := strings.CutPrefix(str, "<"); found {
+		res.To = value
+		res.ToExclusive = true
+	} else {
+		res.From = str
+		res.To = str
+	}
+
+	if res.From == "" && res.To == "" {
+		return res, false
+	}
+	for _, date := range []string{res.From, res.To} {
+		if date != "" && !isPartialDate(date) {
+			return res, false
+		}
+	}
+
+	return res, true
+}
+
+// isPartialDate checks if the date is in the format YYYY, YYYY-MM or YYYY-MM-DD.
+func isPartialDate(date string) bool {
+	if len(date) != 4 && len(date) != 7 && len(date) != 10 {
+		return false
+	}
+
+	for i, ch := range date {
+		if i == 4 || i == 7 {
+			if ch != '-' {
+				return false
+			}
+		} else if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *filterParser) nextIsOperator(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == ftkOperator && p.tokens[p.pos].op == op
+}
+
+// error creates an error pointing at the current token, or the end of the query if there are no more.
+func (p *filterParser) error(code, message string) error {
+	if p.pos >= len(p.tokens) {
+		return p.errorAt(filterToken{start: len(p.str), end: len(p.str)}, code, message)
+	}
+
+	return p.errorAt(p.tokens[p.pos], code, message)
+}
+
+func (p *filterParser) errorAt(token filterToken, code, message string) error {
+	return newFilterParseError(p.str, token, len(p.filter.Terms), code, message)
+}
+
+func newFilterParseError(str string, token filterToken, term int, code, message string) FilterParseError {
+	return FilterParseError{
+		Term:      term,
+		Code:      code,
+		Message:   message,
+		Token:     str[token.start:token.end],
+		Start:     token.start,
+		End:       token.end,
+		RuneStart: utf8.RuneCountInString(str[:token.start]),
+		RuneEnd:   utf8.RuneCountInString(str[:token.end]),
+	}
+}
+
+// tokenizeFilter splits the query into terms, operators and parentheses. Quoted text is kept
+// as-is within the term, so that operators and parentheses can be searched for.
+func tokenizeFilter(str string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0, 16)
+	termStart := -1
+	flushTerm := func(end int) {
+		if termStart == -1 {
+			return
+		}
+
+		text := strings.TrimRight(str[termStart:end], " \t\n")
+		tokens = append(tokens, filterToken{kind: ftkTerm, text: text, start: termStart, end: termStart + len(text)})
+		termStart = -1
+	}
+
+	pos := 0
+	for pos < len(str) {
+		ch := str[pos]
+
+		if termStart == -1 {
+			switch ch {
+			case ' ', '\t', '\n':
+				pos += 1
+				continue
+			case '!':
+				tokens = append(tokens, filterToken{kind: ftkNot, text: "!", start: pos, end: pos + 1})
+				pos += 1
+				continue
+			}
+
+			if length := exclusionLength(str, pos); length > 0 {
+				tokens = append(tokens, filterToken{kind: ftkExclude, text: str[pos : pos+length], start: pos, end: pos + length})
+				pos += length
+				continue
+			}
+		} else if strings.ContainsRune(" \t\n", rune(str[pos-1])) {
+			// Without this, `uvan -fpom` would be looked up as a single word.
+			if length := exclusionLength(str, pos); length > 0 {
+				token := filterToken{start: pos, end: pos + length}
+				return nil, newFilterParseError(str, token, countFilterTerms(tokens), "missing_operator", "An exclusion must be joined to the term before it by an operator, like `uvan && -fpom`.")
+			}
+		}
+
+		if ch == '/' && termStart == -1 {
+			endIndex := indexUnescaped(str[pos+1:], '/')
+			if endIndex == -1 {
+				token := filterToken{start: pos, end: len(str)}
+				return nil, newFilterParseError(str, token, countFilterTerms(tokens), "unterminated_regex", "A regular expression is missing its closing slash.")
+			}
+
+			termStart = pos
+			pos += endIndex + 2
+			continue
+		}
+
+		if ch == '"' {
+			endIndex := strings.IndexByte(str[pos+1:], '"')
+			if endIndex == -1 {
+				token := filterToken{start: pos, end: len(str)}
+				return nil, newFilterParseError(str, token, countFilterTerms(tokens), "unterminated_text", "A quoted text is missing its closing quote.")
+			}
+
+			if termStart == -1 {
+				termStart = pos
+			}
+			pos += endIndex + 2
+			continue
+		}
+
+		if ch == '(' || ch == ')' {
+			flushTerm(pos)
+			kind := ftkOpen
+			if ch == ')' {
+				kind = ftkClose
+			}
+
+			tokens = append(tokens, filterToken{kind: kind, text: str[pos : pos+1], start: pos, end: pos + 1})
+			pos += 1
+			continue
+		}
+
+		if op, length := matchFilterOperator(str, pos); length > 0 {
+			flushTerm(pos)
+			token := filterToken{kind: ftkOperator, op: op, start: pos, end: pos + length}
+
+			if isDistanceOperator(op) {
+				end := token.end
+				for end < len(str) && str[end] == ' ' {
+					end += 1
+				}
+				digitsStart := end
+				for end < len(str) && str[end] >= '0' && str[end] <= '9' {
+					token.distance = (token.distance * 10) + int(str[end]-'0')
+					end += 1
+				}
+
+				if end == digitsStart || token.distance == 0 {
+					return nil, newFilterParseError(str, token, countFilterTerms(tokens), "missing_distance", "A proximity operator must be followed by a distance of at least 1 word.")
+				}
+
+				token.end = end
+			}
+
+			token.text = str[token.start:token.end]
+			tokens = append(tokens, token)
+			pos = token.end
+			continue
+		}
+
+		if termStart == -1 {
+			termStart = pos
+		}
+		pos += 1
+	}
+	flushTerm(len(str))
+
+	return tokens, nil
+}
+
+// exclusionLength gives the length of the "-" or "NOT" at the position, or 0 if there is none. They must be
+// followed by what they exclude, and not a space or the end of the query.
+func exclusionLength(str string, pos int) int {
+	switch {
+	case str[pos] == '-' && pos+1 < len(str) && !strings.ContainsRune(" \t\n)", rune(str[pos+1])):
+		return 1
+	case strings.HasPrefix(str[pos:], "NOT") && pos+3 < len(str) && strings.ContainsRune(" \t\n(", rune(str[pos+3])):
+		return 3
+	default:
+		return 0
+	}
+}
+
+// indexUnescaped is like strings.IndexByte, but skips occurrences escaped with a backslash.
+func indexUnescaped(str string, ch byte) int {
+	for i := 0; i < len(str); i++ {
+		if str[i] == '\\' {
+			i += 1
+		} else if str[i] == ch {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// matchFilterOperator finds the longest operator alias at the position. Aliases written in words
+// must be surrounded by spaces, parentheses or the ends of the query.
+func matchFilterOperator(str string, pos int) (string, int) {
+	selectedOp := ""
+	longest := 0
+	for _, alias := range operatorAliases {
+		match := alias[0]
+		if len(match) <= longest || !strings.HasPrefix(str[pos:], match) {
+			continue
+		}
+
+		if match[0] >= 'A' && match[0] <= 'Z' {
+			if pos > 0 && !strings.ContainsRune(" \t\n)", rune(str[pos-1])) {
+				continue
+			}
+			if end := pos + len(match); end < len(str) && !strings.ContainsRune(" \t\n(!\"", rune(str[end])) {
+				continue
+			}
+		}
+
+		selectedOp = alias[1]
+		longest = len(match)
+	}
+
+	return selectedOp, longest
+}
+
+func countFilterTerms(tokens []filterToken) int {
+	count := 0
+	for _, token := range tokens {
+		if token.kind == ftkTerm {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+type filterToken struct {
+	kind     filterTokenKind
+	op       string
+	distance int
+	text     string
+	start    int
+	end      int
+}
+
+type filterTokenKind int
+
+const (
+	ftkTerm filterTokenKind = iota
+	ftkOperator
+	ftkOpen
+	ftkClose
+	ftkNot
+	ftkExclude
+)
@@ -0,0 +1,304 @@
+package sarfya
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// CompleteFilterString finds out what is being written at the cursor of a partial filter, and suggests
+// the constraints, flags, options and operators that can be written there. The cursor is counted in runes,
+// and is clamped to the filter. It does not look anything up, so words and source IDs must be suggested by
+// the caller for FCKWord and FCKSource.
+func CompleteFilterString(str string, cursor int) FilterCompletion {
+	if cursor < 0 || cursor > utf8.RuneCountInString(str) {
+		cursor = utf8.RuneCountInString(str)
+	}
+	end := len(str)
+	if cursor < utf8.RuneCountInString(str) {
+		end = 0
+		for i := 0; i < cursor; i++ {
+			_, size := utf8.DecodeRuneInString(str[end:])
+			end += size
+		}
+	}
+	before := str[:end]
+
+	res := FilterCompletion{Kind: FCKNone, Start: end, End: end, RuneStart: cursor, RuneEnd: cursor}
+	setPrefix := func(kind FilterCompletionKind, start int) {
+		res.Kind = kind
+		res.Prefix = before[start:]
+		res.Start = start
+		res.RuneStart = utf8.RuneCountInString(before[:start])
+	}
+
+	tokens, err := tokenizeFilter(before)
+	if err != nil {
+		// The cursor is within a quoted text or regular expression, or before a proximity operator's distance.
+		return res
+	}
+
+	if len(tokens) == 0 {
+		setPrefix(FCKWord, end)
+		res.Suggestions = suggestGlobalTerms("")
+		return res
+	}
+
+	last := tokens[len(tokens)-1]
+	if last.end < end {
+		// There is a space between the last token and the cursor, so the term or group is complete.
+		if last.kind == ftkTerm || last.kind == ftkClose {
+			setPrefix(FCKOperator, end)
+			res.Suggestions = suggestOperators("")
+		} else {
+			setPrefix(FCKWord, end)
+			res.Suggestions = suggestGlobalTerms("")
+		}
+
+		return res
+	}
+
+	switch last.kind {
+	case ftkTerm:
+	case ftkOperator:
+		if suggestions := suggestOperators(last.text); len(suggestions) > 1 {
+			setPrefix(FCKOperator, last.start)
+			res.Suggestions = suggestions
+		}
+
+		return res
+	case ftkClose:
+		return res
+	default:
+		setPrefix(FCKWord, end)
+		res.Suggestions = suggestGlobalTerms("")
+		return res
+	}
+
+	text := last.text
+	switch {
+	case strings.HasPrefix(text, "src:"):
+		setPrefix(FCKSource, last.start+4)
+	case strings.HasPrefix(text, "flag:"):
+		setPrefix(FCKFlag, last.start+5)
+		res.Suggestions = suggestFlags(res.Prefix)
+	case strings.HasPrefix(text, "opt:"):
+		setPrefix(FCKOption, last.start+4)
+		if strings.HasPrefix("noadjacent", res.Prefix) {
+			res.Suggestions = []FilterSuggestion{{Kind: FCKOption, Text: "noadjacent", Label: "only non-adjacent matches"}}
+		}
+	case isGlobalFilterTerm(text):
+		// Dates and authors cannot be suggested.
+	case strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "/"):
+		endIndex := strings.LastIndex(text, text[:1])
+		if endIndex > 0 {
+			rest := text[endIndex+1:]
+			if colon := strings.LastIndexByte(rest, ':'); colon != -1 && strings.HasPrefix("fold", rest[colon+1:]) {
+				setPrefix(FCKConstraint, last.start+endIndex+1+colon+1)
+				res.Suggestions = []FilterSuggestion{{Kind: FCKConstraint, Text: "fold", Label: "ignore case and diacritics"}}
+			}
+		}
+	case strings.ContainsRune(text, ':'):
+		colon := strings.LastIndexByte(text, ':')
+		start := colon + 1
+		if bar := strings.LastIndexByte(text[start:], '|'); bar != -1 {
+			start += bar + 1
+		}
+		if strings.HasPrefix(text[start:], "=") {
+			start += 1
+		}
+
+		if strings.HasPrefix(text, "role:") && colon == 4 {
+			setPrefix(FCKConstraint, last.start+start)
+			res.Suggestions = suggestRoles(res.Prefix, "")
+		} else if !strings.ContainsRune(text[start:], '=') {
+			setPrefix(FCKConstraint, last.start+start)
+			res.Suggestions = suggestConstraints(res.Prefix)
+		}
+	default:
+		// A partial operator written in words, like `uvan FOLLOWED B`, ends up in the term.
+		for i := 0; i < len(text); i++ {
+			if text[i] == ' ' {
+				if suggestions := suggestOperators(text[i+1:]); len(suggestions) > 0 {
+					setPrefix(FCKOperator, last.start+i+1)
+					res.Suggestions = suggestions
+					return res
+				}
+			}
+		}
+
+		setPrefix(FCKWord, last.start)
+		res.Suggestions = suggestGlobalTerms(res.Prefix)
+	}
+
+	return res
+}
+
+// FilterCompletion is what CompleteFilterString found at the cursor. The suggestions should replace the
+// text from Start to End.
+type FilterCompletion struct {
+	Kind        FilterCompletionKind `json:"kind"`
+	Prefix      string               `json:"prefix"`
+	Start       int                  `json:"start"`
+	End         int                  `json:"end"`
+	RuneStart   int                  `json:"runeStart"`
+	RuneEnd     int                  `json:"runeEnd"`
+	Suggestions []FilterSuggestion   `json:"suggestions"`
+}
+
+type FilterSuggestion struct {
+	Kind    FilterCompletionKind `json:"kind"`
+	Text    string               `json:"text"`
+	Label   string               `json:"label,omitempty"`
+	EntryID string               `json:"entryId,omitempty"`
+}
+
+type FilterCompletionKind string
+
+const (
+	// FCKNone is for places where nothing can be suggested, like within quoted text or dates.
+	FCKNone       FilterCompletionKind = ""
+	FCKWord       FilterCompletionKind = "word"
+	FCKGlobal     FilterCompletionKind = "global"
+	FCKConstraint FilterCompletionKind = "constraint"
+	FCKFlag       FilterCompletionKind = "flag"
+	FCKSource     FilterCompletionKind = "source"
+	FCKOption     FilterCompletionKind = "option"
+	FCKOperator   FilterCompletionKind = "operator"
+)
+
+// filterPartsOfSpeech are the parts of speech suggested as constraints.
+var filterPartsOfSpeech = []string{
+	"n.", "pn.", "prop.n.", "adj.", "adv.", "adp.", "conj.", "inter.", "intj.", "num.", "part.", "ph.", "sbd.",
+	"vin.", "vtr.", "vim.", "vtrm.", "vm.", "svin.",
+}
+
+// filterSuggestedPrefixes are the prefixes suggested as constraints. Unlike suffixes and infixes, the
+// prefixes have no alias table to take them from.
+var filterSuggestedPrefixes = []string{"ay", "me", "pxe", "fì", "tsa", "fra", "pe", "tì", "nì", "sä", "le", "a"}
+
+func suggestGlobalTerms(prefix string) []FilterSuggestion {
+	globals := [][2]string{
+		{"src:", "source ID"},
+		{"date:", "source date, like 2014 or 2012..2014"},
+		{"author:", "source author"},
+		{"flag:", "example flag"},
+		{"opt:", "option"},
+		{"role:", "word linked by an annotation"},
+	}
+
+	res := make([]FilterSuggestion, 0, len(globals))
+	for _, global := range globals {
+		if strings.HasPrefix(global[0], prefix) {
+			res = append(res, FilterSuggestion{Kind: FCKGlobal, Text: global[0], Label: global[1]})
+		}
+	}
+
+	return res
+}
+
+func suggestFlags(prefix string) []FilterSuggestion {
+	negated := strings.HasPrefix(prefix, "-")
+
+	res := make([]FilterSuggestion, 0, len(exampleFlags))
+	for _, flag := range exampleFlags {
+		text := string(flag)
+		label := ""
+		if negated {
+			text = "-" + text
+			label = "without flag"
+		}
+
+		if strings.HasPrefix(text, prefix) {
+			res = append(res, FilterSuggestion{Kind: FCKFlag, Text: text, Label: label})
+		}
+	}
+
+	return res
+}
+
+func suggestRoles(prefix, marker string) []FilterSuggestion {
+	res := make([]FilterSuggestion, 0, len(annotationLinkKeys))
+	for _, role := range annotationLinkKeys {
+		if strings.HasPrefix(marker+role, prefix) {
+			res = append(res, FilterSuggestion{Kind: FCKConstraint, Text: marker + role, Label: "role"})
+		}
+	}
+
+	return res
+}
+
+func suggestConstraints(prefix string) []FilterSuggestion {
+	res := make([]FilterSuggestion, 0, 16)
+	add := func(text, label string) {
+		if !strings.HasPrefix(text, prefix) {
+			return
+		}
+		for _, suggestion := range res {
+			if suggestion.Text == text {
+				return
+			}
+		}
+
+		res = append(res, FilterSuggestion{Kind: FCKConstraint, Text: text, Label: label})
+	}
+
+	add("noaffix", "no affixes")
+	add("noprefix", "no prefixes")
+	add("noinfix", "no infixes")
+	add("nosuffix", "no suffixes")
+	add("nolen", "no lenition")
+	for _, pos := range filterPartsOfSpeech {
+		add(pos, "part of speech")
+	}
+	for _, prefix := range filterSuggestedPrefixes {
+		add(prefix+"-", "prefix")
+	}
+	for _, suffix := range sortedAliasTable(suffixAliases) {
+		add("-"+suffix, "suffix")
+	}
+	for _, infix := range sortedAliasTable(infixAliases) {
+		add("<"+infix+">", "infix")
+	}
+	res = append(res, suggestRoles(prefix, "@")...)
+
+	return res
+}
+
+// suggestOperators suggests the operators and their aliases that start with the prefix.
+func suggestOperators(prefix string) []FilterSuggestion {
+	res := make([]FilterSuggestion, 0, len(operatorAliases))
+	for _, alias := range operatorAliases {
+		if !strings.HasPrefix(alias[0], prefix) {
+			continue
+		}
+
+		label := ""
+		if alias[0] != alias[1] {
+			label = alias[1]
+		}
+
+		res = append(res, FilterSuggestion{Kind: FCKOperator, Text: alias[0], Label: label})
+	}
+
+	return res
+}
+
+// sortedAliasTable lists both the aliases and the forms they stand for, with the latter first.
+func sortedAliasTable(table map[string]string) []string {
+	res := make([]string, 0, len(table)*2)
+	for _, value := range table {
+		if !inStringList(res, value, nil) {
+			res = append(res, value)
+		}
+	}
+	slices.Sort(res)
+
+	aliases := make([]string, 0, len(table))
+	for alias := range table {
+		aliases = append(aliases, alias)
+	}
+	slices.Sort(aliases)
+
+	return append(res, aliases...)
+}
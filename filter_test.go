@@ -1,6 +1,8 @@
 package sarfya
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -166,3 +168,723 @@ func TestWordFilter_Check(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFilter(t *testing.T) {
+	table := []struct {
+		Label  string
+		Filter string
+		Terms  []FilterTerm
+		Root   *FilterNode
+	}{
+		{
+			"Single term",
+			"uvan",
+			[]FilterTerm{{Word: "uvan"}},
+			&FilterNode{Term: 0},
+		},
+		{
+			"Positional operators bind tighter than && and ||",
+			"oe || uvan && a +> lu",
+			[]FilterTerm{
+				{Word: "oe"},
+				{Word: "uvan"},
+				{Word: "a"},
+				{Word: "lu"},
+			},
+			&FilterNode{Operator: FTOOr, Children: []FilterNode{
+				{Term: 0},
+				{Operator: FTOAnd, Children: []FilterNode{
+					{Term: 1},
+					{Operator: FTOFollowedBy, Children: []FilterNode{{Term: 2}, {Term: 3}}},
+				}},
+			}},
+		},
+		{
+			"Parentheses group alternatives",
+			"(tsun || new) +> si",
+			[]FilterTerm{
+				{Word: "tsun"},
+				{Word: "new"},
+				{Word: "si"},
+			},
+			&FilterNode{Operator: FTOFollowedBy, Children: []FilterNode{
+				{Operator: FTOOr, Children: []FilterNode{{Term: 0}, {Term: 1}}},
+				{Term: 2},
+			}},
+		},
+		{
+			"Negated group and negated term",
+			"fpom:n. AND !(nga || !oe)",
+			[]FilterTerm{
+				{Word: "fpom", Constraints: WordFilter{"n."}},
+				{Word: "nga"},
+				{Word: "oe", Constraints: nil, Not: true},
+			},
+			&FilterNode{Operator: FTOAnd, Children: []FilterNode{
+				{Term: 0},
+				{Operator: FTONot, Children: []FilterNode{
+					{Operator: FTOOr, Children: []FilterNode{{Term: 1}, {Term: 2}}},
+				}},
+			}},
+		},
+		{
+			"Text with operators and global terms",
+			"src:test-source && \"a || (b)\":en && flag:-poetry",
+			[]FilterTerm{
+				{Word: "a || (b)", Constraints: WordFilter{"en"}, IsText: true},
+			},
+			&FilterNode{Term: 0},
+		},
+		{
+			"Definition term with constraints",
+			"en:\"to want, (or) wish\":vtr. +> pt_br:\"jogo\"",
+			[]FilterTerm{
+				{Word: "to want, (or) wish", Constraints: WordFilter{"vtr."}, DefinitionLang: "en"},
+				{Word: "jogo", DefinitionLang: "pt_br"},
+			},
+			&FilterNode{Operator: FTOFollowedBy, Children: []FilterNode{{Term: 0}, {Term: 1}}},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Label, func(t *testing.T) {
+			filter, err := ParseFilterString(tt.Filter)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.Terms, filter.Terms)
+			assert.Equal(t, tt.Root, filter.Root)
+		})
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	table := []struct {
+		Filter string
+		Code   string
+	}{
+		{"(uvan + a", "unbalanced_parenthesis"},
+		{"uvan + a)", "unbalanced_parenthesis"},
+		{"uvan (a)", "missing_operator"},
+		{"uvan ||", "empty_query_term"},
+		{"uvan && () && a", "empty_query_term"},
+		{"src:test || uvan", "misplaced_global_term"},
+		{"(uvan && flag:poetry)", "misplaced_global_term"},
+		{"flag:stuff", "flag_not_understood"},
+		{"\"unterminated", "unterminated_text"},
+		{"uvan ~ a", "missing_distance"},
+		{"date:2014-6", "date_not_understood"},
+		{"date:..", "date_not_understood"},
+		{"uvan || author:\"Paul Frommer\"", "misplaced_global_term"},
+		{"uvan WITHIN 0 a", "missing_distance"},
+		{"a && b && c && d && e && f && g && h && i", "too_many_terms"},
+		{"-fpom +> uvan", "misplaced_exclusion"},
+		{"uvan +> -fpom", "misplaced_exclusion"},
+		{"uvan -fpom", "missing_operator"},
+		{"uvan NOT fpom", "missing_operator"},
+		{"uvan NOT(a || b)", "missing_operator"},
+		{"!(a || b) +>> c", "misplaced_exclusion"},
+		{"a + b ~2 NOT c", "misplaced_exclusion"},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			_, err := ParseFilterString(tt.Filter)
+			var parseErr FilterParseError
+			if assert.ErrorAs(t, err, &parseErr) {
+				assert.Equal(t, tt.Code, parseErr.Code)
+			}
+		})
+	}
+}
+
+func TestFilter_CheckExample(t *testing.T) {
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	proximityExample, err := NewExample(context.Background(), Input{Text: "1Oe 2lu. 3uvan 4lu."}, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rolesExample, err := NewExample(context.Background(), Input{
+		Text: "1Oe 2lu 3uvan.",
+		Annotations: []Annotation{
+			{Kind: AKVerbParameters, Links: map[string][]int{
+				"verb":      {2},
+				"subject":   {1},
+				"predicate": {3},
+			}},
+		},
+	}, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	table := []struct {
+		Example *Example
+		Filter  string
+		Spans   [][]int
+	}{
+		{example, "uvan + a", [][]int{{0, 2}}},
+		{example, "(uvan || oe) + a", [][]int{{0, 2}, {2, 4}}},
+		{example, "lu || oe +> 'o'", [][]int{{8}}},
+		{example, "(lu || oe) +> 'o'", [][]int{{8, 10}}},
+		{example, "uvan && !(lu +> uvan)", [][]int{{0}}},
+		{example, "uvan && !(lu || oe)", nil},
+		{example, "-fpom", [][]int{}},
+		{example, "-uvan", nil},
+		{example, "uvan && -lu", nil},
+		{example, "uvan && NOT fpom", [][]int{{0}}},
+		{example, "uvan && NOT (oe +> lu)", [][]int{{0}}},
+		{example, "uvan && -!uvan", nil},
+		{example, "!oe:pn. && -oe", nil},
+		{example, "!uvan:n.", [][]int{{2}, {4}, {6}, {8}, {10}}},
+		{example, "\"oe\" +>> 'o'", [][]int{{4, 10}}},
+		{example, "\"uvan a oe\"", [][]int{{0, 1, 2, 3, 4}}},
+		{example, "\"'o\"", [][]int{{4}, {6}, {10}}},
+		{example, "\"'o\":fold", [][]int{{10}}},
+		{example, "\"UVÁN\":fold", [][]int{{0}}},
+		{example, "/o\\w* lu/", [][]int{{6, 7, 8}}},
+		{example, "/\\bs\\w+/ +> lu", [][]int{{6, 8}}},
+		{example, "/g[a-z]+e/:en", [][]int{{0}}},
+		{example, "/UVÄN/", nil},
+		{example, "/UVÄN/:fold", [][]int{{0}}},
+		{example, "/(oe|lu) (soli|o)/", [][]int{{4, 5, 6}, {8, 9, 10}}},
+		{example, "uvan >+< *:pn.", nil},
+		{example, "(uvan +>> lu) >+< *:pn.", [][]int{{0, 4, 8}}},
+		{example, "uvan ~2 oe", [][]int{{0, 4}}},
+		{example, "uvan ~1 oe", nil},
+		{example, "oe ~2 uvan", [][]int{{0, 4}}},
+		{example, "oe ~>2 uvan", nil},
+		{example, "uvan FOLLOWED WITHIN 3 *:vin.", [][]int{{0, 6}}},
+		{proximityExample, "oe ~3 uvan", nil},
+		{proximityExample, "uvan ~3 oe", nil},
+		{proximityExample, "oe WITHIN ACROSS 3 uvan", [][]int{{0, 4}}},
+		{proximityExample, "uvan ~.3 oe", [][]int{{0, 4}}},
+		{proximityExample, "oe ~.>2 uvan", [][]int{{0, 4}}},
+		{proximityExample, "oe ~.>1 uvan", nil},
+		{proximityExample, "lu ~>1 lu", nil},
+		{proximityExample, "lu ~.>1 uvan", [][]int{{2, 4}}},
+		{rolesExample, "role:subject", [][]int{{0}}},
+		{rolesExample, "*:@predicate:n.", [][]int{{4}}},
+		{rolesExample, "lu:@subject=oe", [][]int{{0, 2}}},
+		{rolesExample, "lu:@subject=*:n.", nil},
+		{rolesExample, "lu:@predicate=*:n.", [][]int{{2, 4}}},
+		{rolesExample, "*:@dative", nil},
+		{rolesExample, "role:verb +> uvan", [][]int{{2, 4}}},
+		{example, "uvan:@noun", [][]int{{0}}},
+		{example, "*:@noun=uvan:n.", [][]int{{0, 6}}},
+		{example, "*:@si", [][]int{{6}}},
+	}
+
+	dictionary := dummyDict.with(wordFpom)
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, candidates, err := ParseFilter(context.Background(), tt.Filter, dictionary)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			match := filter.CheckExample(*tt.Example, candidates)
+			if tt.Spans == nil {
+				assert.Nil(t, match)
+			} else if assert.NotNil(t, match) {
+				assert.Equal(t, tt.Spans, match.Spans)
+			}
+		})
+	}
+}
+
+func TestFilter_String(t *testing.T) {
+	table := []struct {
+		Filter    string
+		Canonical string
+	}{
+		{"", ""},
+		{"uvan", "uvan"},
+		{"uvan:n.:-ti  +   a", "uvan:n.:-ti + a"},
+		{"oe OR uvan AND a FOLLOWED BY lu", "oe || uvan && a +> lu"},
+		{"(tsun || (new)) +> si", "(tsun || new) +> si"},
+		{"a && (b && c) || (d || e)", "a && b && c || d || e"},
+		{"a + (b + c) + d", "a + (b + c) + d"},
+		{"(a || b) && (c || d)", "(a || b) && (c || d)"},
+		{"fpom && !(nga || !oe)", "fpom && !(nga || !oe)"},
+		{"!(uvan)", "!(uvan)"},
+		{"flag:-poetry && a || b && src:test && option:no_adjacent", ""},
+		{"flag:-poetry && src:test && (a || b) && opt:no_adjacent", "src:test && flag:-poetry && opt:noadjacent && (a || b)"},
+		{"\"Kaltxì, ma (tsmukan)\":en", "\"Kaltxì, ma (tsmukan)\":en"},
+		{"a WITHIN 3 b FOLLOWED WITHIN ACROSS 12 c", "a ~3 b ~.>12 c"},
+		{"flag:poetry && author:\"Paul Frommer\" && date:>=2015-01 && uvan && date:2012..2014 && src:x", "src:x && date:>=2015-01 && date:2012..2014 && author:\"Paul Frommer\" && flag:poetry && uvan"},
+		{"date:<2014 && date:>2010-06-01 && date:2011-02 && author:Frommer", "date:<2014 && date:>2010-06-01 && date:2011-02 && author:\"Frommer\""},
+		{"a ~.2 (b ~>1 c)", "a ~.2 (b ~>1 c)"},
+		{"role:agent", "*:@agent"},
+		{"uvan && -fpom", "uvan && !(fpom)"},
+		{"NOT fpom || NOT(a && b)", "!(fpom) || !(a && b)"},
+		{"c && -(a || b)", "c && !(a || b)"},
+		{"uvan && -!uvan:n.", "uvan && !(!uvan:n.)"},
+		{"uvan && -src:test", ""},
+		{"NOTE + a:-ti", "NOTE + a:-ti"},
+		{"\"kameie\":fold:en", "\"kameie\":en:fold"},
+		{"\"fold\":fold", "\"fold\":fold"},
+		{"\"kameie\":en:de", ""},
+		{"/a\\/b/:en:fold", "/a\\/b/:en:fold"},
+		{"/(a|b)+ c/ +> !/d?/", "/(a|b)+ c/ +> !/d?/"},
+		{"/(/", ""},
+		{"/abc", ""},
+		{"//", ""},
+		{"taron:v.:@patient=*:n.:-ti", "taron:v.:@patient=*:n.:-ti"},
+		{"role:dative:@subject=oe", "*:@dative:@subject=oe"},
+		{"*:@nonsense", ""},
+		{"author:\"a)\" && uvan", "author:\"a)\" && uvan"},
+		{"author:a!\"WITHIN 2-&&\"", ""},
+		{"author:\"a\"\"", ""},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, err := ParseFilterString(tt.Filter)
+			if tt.Canonical == "" && tt.Filter != "" {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.Canonical, filter.String())
+
+			reparsed, err := ParseFilterString(filter.String())
+			assert.NoError(t, err)
+			assert.Equal(t, filter, reparsed)
+
+			data, err := json.Marshal(filter)
+			assert.NoError(t, err)
+			decoded := &Filter{}
+			assert.NoError(t, json.Unmarshal(data, decoded))
+			assert.NoError(t, decoded.Validate())
+			assert.Equal(t, filter, decoded)
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	terms := []FilterTerm{{Word: "uvan"}, {Word: "a"}}
+
+	assert.NoError(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTONextTo, Children: []FilterNode{{Term: 0}, {Term: 1}}}}).Validate())
+	assert.Error(t, (&Filter{Terms: terms, Root: &FilterNode{Term: 2}}).Validate())
+	assert.Error(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTONextTo, Children: []FilterNode{{Term: 0}}}}).Validate())
+	assert.Error(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: "??", Children: []FilterNode{{Term: 0}, {Term: 1}}}}).Validate())
+	assert.Error(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTOAnd, Children: []FilterNode{{Term: 0}}}}).Validate())
+	assert.Error(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTOFollowedBy, Children: []FilterNode{{Term: 0}, {Operator: FTONot, Children: []FilterNode{{Term: 1}}}}}}).Validate())
+	assert.Error(t, (&Filter{Authors: []string{"a\"b"}}).Validate())
+
+	var parseErr FilterParseError
+	if assert.ErrorAs(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTOAnd, Children: []FilterNode{{Term: 0}, {Operator: FTOWithin, Children: []FilterNode{{Term: 1}, {Term: 0}}}}}}).Validate(), &parseErr) {
+		assert.Equal(t, 1, parseErr.Term)
+		assert.Equal(t, FTOWithin, parseErr.Token)
+	}
+	if assert.ErrorAs(t, (&Filter{Terms: terms, Root: &FilterNode{Operator: FTOOr}}).Validate(), &parseErr) {
+		assert.Equal(t, -1, parseErr.Term)
+		assert.Equal(t, FTOOr, parseErr.Token)
+	}
+	if assert.ErrorAs(t, (&Filter{Terms: []FilterTerm{{Word: "(", IsText: true, IsRegex: true}}, Root: &FilterNode{Term: 0}}).Validate(), &parseErr) {
+		assert.Equal(t, 0, parseErr.Term)
+		assert.Equal(t, "/(/", parseErr.Token)
+	}
+
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded := &Filter{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"terms":[{"word":"uv(a|o)n","isText":true,"isRegex":true}],"root":{"term":0}}`), decoded))
+	assert.NotNil(t, decoded.CheckExample(*example, nil))
+	assert.NoError(t, decoded.Validate())
+	assert.NotNil(t, decoded.CheckExample(*example, nil))
+
+	invalid := &Filter{Terms: []FilterTerm{{Word: "(", IsText: true, IsRegex: true}}, Root: &FilterNode{Term: 0}}
+	assert.Nil(t, invalid.CheckExample(*example, nil))
+	assert.Error(t, invalid.Validate())
+}
+
+func TestParseFilter_ErrorPositions(t *testing.T) {
+	table := []struct {
+		Filter    string
+		Code      string
+		Token     string
+		Start     int
+		End       int
+		RuneStart int
+		RuneEnd   int
+	}{
+		{"uvan && (oe +> lu", "unbalanced_parenthesis", "(", 8, 9, 8, 9},
+		{"uvan +> lu)", "unbalanced_parenthesis", ")", 10, 11, 10, 11},
+		{"'o' +", "empty_query_term", "", 5, 5, 5, 5},
+		{"ìlä + (src:test)", "misplaced_global_term", "src:test", 9, 17, 7, 15},
+		{"tìftang && \"uvan", "unterminated_text", "\"uvan", 12, 17, 11, 16},
+		{"uvan +> tìkangkem:n.", "no_matched_entries", "tìkangkem:n.", 8, 21, 8, 20},
+		{"uvan && flag:notaflag", "flag_not_understood", "flag:notaflag", 8, 21, 8, 21},
+		{"ìlä +> -(oe || lu)", "misplaced_exclusion", "-", 9, 10, 7, 8},
+		{"ìlä -fpom", "missing_operator", "-", 6, 7, 4, 5},
+		{"uvan soli NOT fpom", "missing_operator", "NOT", 10, 13, 10, 13},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			_, _, err := ParseFilter(context.Background(), tt.Filter, dummyDict)
+			var parseErr FilterParseError
+			if assert.ErrorAs(t, err, &parseErr) {
+				assert.Equal(t, tt.Code, parseErr.Code)
+				assert.Equal(t, tt.Token, parseErr.Token)
+				assert.Equal(t, tt.Start, parseErr.Start)
+				assert.Equal(t, tt.End, parseErr.End)
+				assert.Equal(t, tt.RuneStart, parseErr.RuneStart)
+				assert.Equal(t, tt.RuneEnd, parseErr.RuneEnd)
+			}
+		})
+	}
+}
+
+func TestMatchWordPattern(t *testing.T) {
+	table := []struct {
+		Pattern  string
+		Word     string
+		Expected bool
+	}{
+		{"tì*", "tìkangkem", true},
+		{"tì*", "Tìkangkem", true},
+		{"tì*", "tikangkem", false},
+		{"*yu", "taronyu", true},
+		{"*yu", "taronyut", false},
+		{"t*ng*m", "tìkangkem", true},
+		{"?e", "oe", true},
+		{"?e", "fpe'", false},
+		{"uvan*", "uvan", true},
+		{"*", "", true},
+		{"**a", "a", true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Pattern+" "+tt.Word, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, matchWordPattern(tt.Pattern, tt.Word))
+		})
+	}
+}
+
+func TestParseFilter_Patterns(t *testing.T) {
+	filter, candidates, err := ParseFilter(context.Background(), "uvan* + ?", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[int][]DictionaryEntry{
+		0: {dummyDict["uvan"], dummyDict["uvan soli"]},
+		1: {dummyDict["a"]},
+	}, candidates)
+	assert.False(t, filter.NeedFullList())
+
+	_, _, err = ParseFilter(context.Background(), "uvan && tsa*", dummyDict)
+	var parseErr FilterParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "no_matched_entries", parseErr.Code)
+		assert.Equal(t, "tsa*", parseErr.Token)
+	}
+
+	_, _, err = ParseFilter(context.Background(), "tsa*", CombinedDictionary{})
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "pattern_not_supported", parseErr.Code)
+	}
+}
+
+func TestFilter_CheckExample_Entries(t *testing.T) {
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	table := []struct {
+		Filter  string
+		Entries []DictionaryEntry
+	}{
+		{"uvan*", []DictionaryEntry{dummyDict["uvan"], dummyDict["uvan soli"]}},
+		{"uvan* + a", []DictionaryEntry{dummyDict["uvan"], dummyDict["a"]}},
+		{"* +> uvan*:vin.", []DictionaryEntry{dummyDict["uvan soli"]}},
+		{"\"oe\" || !uvan", nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, candidates, err := ParseFilter(context.Background(), tt.Filter, dummyDict)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			match := filter.CheckExample(*example, candidates)
+			if assert.NotNil(t, match) {
+				assert.Equal(t, tt.Entries, match.Entries)
+			}
+		})
+	}
+}
+
+func TestFilterDateRange_Check(t *testing.T) {
+	table := []struct {
+		Range    string
+		Date     string
+		Expected bool
+	}{
+		{"2014", "2014-06-28", true},
+		{"2014", "2015-01-01", false},
+		{">=2015-01", "2015-01-05", true},
+		{">=2015-01", "2014-12-31", false},
+		{">2015-01", "2015-01-31", false},
+		{">2015-01", "2015-02-01", true},
+		{"<=2014", "2014-12-31", true},
+		{"<2014", "2014-01-01", false},
+		{"<2014", "2013-12-31", true},
+		{"2012..2014", "2012-01-01", true},
+		{"2012..2014", "2014-12-31", true},
+		{"2012..2014", "2015-01-01", false},
+		{"2012-06..", "2012-06-01", true},
+		{"..2012-06", "2012-07-01", false},
+		{"2012", "", false},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Range+" "+tt.Date, func(t *testing.T) {
+			dateRange, ok := parseFilterDateRange(tt.Range)
+			assert.True(t, ok)
+			assert.Equal(t, tt.Expected, dateRange.Check(tt.Date))
+		})
+	}
+}
+
+func TestFilter_CheckSource(t *testing.T) {
+	source := Source{ID: "naviteri-2014-05-31", Date: "2014-05-31", Author: "Paul Frommer"}
+
+	table := []struct {
+		Filter   string
+		Expected bool
+	}{
+		{"date:2014", true},
+		{"date:2012..2013", false},
+		{"author:\"paul frommer\"", true},
+		{"author:frommer && date:>=2014-05", true},
+		{"author:gissleh", false},
+		{"src:naviteri-2014-05-31 && date:<2015", true},
+		{"src:other && date:<2015", false},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, err := ParseFilterString(tt.Filter)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.Expected, filter.CheckSource(source))
+			}
+		})
+	}
+}
+
+func TestFilter_ExplainExample(t *testing.T) {
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filter, candidates, err := ParseFilter(context.Background(), "(uvan || oe) +>> lu && !(a +>> lu)", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	explanation := filter.ExplainExample(*example, candidates)
+	assert.False(t, explanation.Matched)
+	assert.Empty(t, explanation.Reason)
+
+	passed := make([]bool, 0, len(explanation.Nodes))
+	expressions := make([]string, 0, len(explanation.Nodes))
+	for _, node := range explanation.Nodes {
+		passed = append(passed, node.Passed)
+		expressions = append(expressions, node.Expression)
+	}
+	assert.Equal(t, []string{"(uvan || oe) +>> lu && !(a +>> lu)", "(uvan || oe) +>> lu", "uvan || oe", "uvan", "oe", "lu", "!(a +>> lu)", "a +>> lu", "a", "lu"}, expressions)
+	assert.Equal(t, []bool{false, true, true, true, true, true, false, true, true, true}, passed)
+	assert.Equal(t, "Not all the parts matched.", explanation.Nodes[0].Reason)
+	assert.Equal(t, "The excluded expression matched.", explanation.Nodes[6].Reason)
+	assert.Equal(t, [][]int{{2, 8}}, explanation.Nodes[7].Spans)
+	assert.Nil(t, filter.CheckExample(*example, candidates))
+
+	filter, candidates, err = ParseFilter(context.Background(), "flag:-non_canon && uvan", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	explanation = filter.ExplainExample(*example, candidates)
+	assert.False(t, explanation.Matched)
+	assert.NotEmpty(t, explanation.Reason)
+	assert.Empty(t, explanation.Nodes)
+
+	adjacentExample, err := NewExample(context.Background(), Input{
+		Text:         "1Oe 2lu.",
+		Translations: map[string]string{"en": "1+2I-am."},
+	}, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	filter, candidates, err = ParseFilter(context.Background(), "oe && opt:noadjacent", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	explanation = filter.ExplainExample(*adjacentExample, candidates)
+	assert.False(t, explanation.Matched)
+	assert.Contains(t, explanation.Reason, "opt:noadjacent")
+	assert.True(t, explanation.Nodes[0].Passed)
+	assert.Nil(t, filter.CheckExample(*adjacentExample, candidates))
+}
+
+func TestFilter_CheckExampleContext(t *testing.T) {
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filter, candidates, err := ParseFilter(context.Background(), "* +>> * && uvan", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	match, err := filter.CheckExampleContext(context.Background(), *example, candidates)
+	assert.NoError(t, err)
+	assert.NotNil(t, match)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	match, err = filter.CheckExampleContext(ctx, *example, candidates)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, match)
+
+	filter, candidates, err = ParseFilter(context.Background(), "-(* +>> *)", dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+	match, err = filter.CheckExampleContext(ctx, *example, candidates)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, match)
+}
+
+func TestCompleteFilterString(t *testing.T) {
+	suggestionTexts := func(suggestions []FilterSuggestion) []string {
+		res := make([]string, 0, len(suggestions))
+		for _, suggestion := range suggestions {
+			res = append(res, suggestion.Text)
+		}
+
+		return res
+	}
+
+	table := []struct {
+		Filter    string
+		Cursor    int
+		Kind      FilterCompletionKind
+		Prefix    string
+		RuneStart int
+		Contains  []string
+		Excludes  []string
+	}{
+		{"", -1, FCKWord, "", 0, []string{"src:", "flag:"}, nil},
+		{"uva", -1, FCKWord, "uva", 0, nil, []string{"src:"}},
+		{"uvan && fl", -1, FCKWord, "fl", 8, []string{"flag:"}, []string{"src:"}},
+		{"uvan ", -1, FCKOperator, "", 5, []string{"&&", "FOLLOWED BY", "+>"}, nil},
+		{"(uvan || lu) ", -1, FCKOperator, "", 13, []string{"||"}, nil},
+		{"uvan FOLLOWED B", -1, FCKOperator, "FOLLOWED B", 5, []string{"FOLLOWED BY", "FOLLOWED BY ACROSS"}, []string{"AND"}},
+		{"uvan +", -1, FCKOperator, "+", 5, []string{"+", "+>", "+.>>"}, []string{"&&"}},
+		{"uvan && ", -1, FCKWord, "", 8, []string{"src:"}, nil},
+		{"uvan:n", -1, FCKConstraint, "n", 5, []string{"n.", "noaffix", "nolen"}, []string{"adj."}},
+		{"uvan:-t", -1, FCKConstraint, "-t", 5, []string{"-t", "-ti"}, []string{"-l"}},
+		{"uvan:<", -1, FCKConstraint, "<", 5, []string{"<äng>", "<eng>"}, nil},
+		{"uvan:adj.|a", -1, FCKConstraint, "a", 10, []string{"adv.", "ay-"}, nil},
+		{"uvan:@pa", -1, FCKConstraint, "@pa", 5, []string{"@patient"}, []string{"@agent"}},
+		{"role:ag", -1, FCKConstraint, "ag", 5, []string{"agent"}, nil},
+		{"uvan && flag:po", -1, FCKFlag, "po", 13, []string{"poetry"}, []string{"proverb"}},
+		{"flag:-p", -1, FCKFlag, "-p", 5, []string{"-poetry", "-proverb"}, []string{"poetry"}},
+		{"uvan && src:ka", -1, FCKSource, "ka", 12, nil, nil},
+		{"opt:no", -1, FCKOption, "no", 4, []string{"noadjacent"}, nil},
+		{"\"kaw", -1, FCKNone, "", 4, nil, nil},
+		{"\"kaw tu\":fo", -1, FCKConstraint, "fo", 9, []string{"fold"}, nil},
+		{"tìfmetok && uvan", 3, FCKWord, "tìf", 0, nil, nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			completion := CompleteFilterString(tt.Filter, tt.Cursor)
+			texts := suggestionTexts(completion.Suggestions)
+
+			assert.Equal(t, tt.Kind, completion.Kind)
+			assert.Equal(t, tt.Prefix, completion.Prefix)
+			assert.Equal(t, tt.RuneStart, completion.RuneStart)
+			for _, text := range tt.Contains {
+				assert.Contains(t, texts, text)
+			}
+			for _, text := range tt.Excludes {
+				assert.NotContains(t, texts, text)
+			}
+		})
+	}
+}
+
+func TestParseFilter_Definitions(t *testing.T) {
+	table := []struct {
+		Filter   string
+		Expected []DictionaryEntry
+	}{
+		{"en:\"game\"", []DictionaryEntry{dummyDict["uvan"]}},
+		{"en:\"to be\"", []DictionaryEntry{dummyDict["lu"]}},
+		{"en:\"Happiness\":n.", []DictionaryEntry{wordFpom}},
+		{"en:\"a game\"", []DictionaryEntry{dummyDict["uvan soli"]}},
+	}
+
+	dictionary := dummyDict.with(wordFpom)
+	for _, tt := range table {
+		t.Run(tt.Filter, func(t *testing.T) {
+			filter, candidates, err := ParseFilter(context.Background(), tt.Filter, dictionary)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.Filter, filter.String())
+				assert.Equal(t, tt.Expected, candidates[0])
+			}
+		})
+	}
+
+	errorTable := []struct {
+		Filter     string
+		Dictionary Dictionary
+		Code       string
+	}{
+		{"en:\"happiness\":vtr.", dictionary, "no_matched_entries"},
+		{"en:\"sky\"", dummyDict, "no_matched_entries"},
+		{"de:\"Spiel\"", dummyDict, "no_matched_entries"},
+		{"tsun:\"x\"", dummyDict, "no_matched_entries"},
+		{"role:\"x\"", dummyDict, "role_not_understood"},
+		{"en:\" \"", dummyDict, "empty_query_term"},
+		{"en:\"game\"s", dummyDict, "definition_not_understood"},
+		{"en:\"game\"", CombinedDictionary{}, "definition_search_not_supported"},
+	}
+
+	for _, tt := range errorTable {
+		t.Run(tt.Filter, func(t *testing.T) {
+			_, _, err := ParseFilter(context.Background(), tt.Filter, tt.Dictionary)
+			var parseErr FilterParseError
+			if assert.ErrorAs(t, err, &parseErr) {
+				assert.Equal(t, tt.Code, parseErr.Code)
+				assert.Empty(t, parseErr.Suggestions)
+			}
+		})
+	}
+
+	example, err := NewExample(context.Background(), validTestInput, dummyDict)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filter, candidates, err := ParseFilter(context.Background(), "en:\"game\" +>> en:\"I\"", dummyDict)
+	if assert.NoError(t, err) {
+		assert.NotNil(t, filter.CheckExample(*example, candidates))
+	}
+}
@@ -0,0 +1,389 @@
+package sarfya
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithMorphology looks up inflected words by taking them apart into a stem and its affixes, and looking up the
+// stem in a dictionary that only knows the base forms. It knows about the case suffixes and their allomorphs,
+// the plural and determiner prefixes, lenition and the verb infixes. The infixes are checked against the
+// entry's InfixIndexes, which are the rune positions of the first and second infixes in the word, or of the
+// pre-first, first and second if there are three of them. A verb without them is not found with infixes.
+//
+// If the dictionary finds the word as it is, its results are given as they are. Otherwise, the analyses with
+// the fewest affixes are given, since the same word can often be taken apart in more than one way.
+func WithMorphology(dictionary Dictionary) Dictionary {
+	return &withMorphology{sub: dictionary}
+}
+
+type withMorphology struct {
+	sub Dictionary
+}
+
+func (d *withMorphology) Entry(ctx context.Context, id string) (*DictionaryEntry, error) {
+	return d.sub.Entry(ctx, id)
+}
+
+func (d *withMorphology) ListEntries(ctx context.Context) ([]DictionaryEntry, error) {
+	return ListDictionaryEntries(ctx, d.sub)
+}
+
+func (d *withMorphology) Lookup(ctx context.Context, search string, allowReef bool) ([]DictionaryEntry, error) {
+	res, err := d.sub.Lookup(ctx, search, allowReef)
+	if err != nil && !errors.Is(err, ErrDictionaryEntryNotFound) {
+		return nil, err
+	}
+	if len(res) > 0 {
+		return res, nil
+	}
+
+	stems := make(map[string][]DictionaryEntry)
+	res = make([]DictionaryEntry, 0, 4)
+	bestCount := -1
+	for _, analysis := range analyseWord(normalizeMorphologyWord(search)) {
+		if bestCount != -1 && analysis.affixCount() > bestCount {
+			break
+		}
+
+		entries, ok := stems[analysis.stem]
+		if !ok {
+			entries, err = d.sub.Lookup(ctx, analysis.stem, allowReef)
+			if err != nil && !errors.Is(err, ErrDictionaryEntryNotFound) {
+				return nil, err
+			}
+
+			stems[analysis.stem] = entries
+		}
+
+		for _, entry := range entries {
+			if normalizeMorphologyWord(strings.TrimSuffix(entry.Word, "+")) != analysis.stem || !analysis.fits(&entry) {
+				continue
+			}
+
+			entry = entry.Copy()
+			entry.Prefixes = append(entry.Prefixes, analysis.prefixes...)
+			entry.Suffixes = append(entry.Suffixes, analysis.suffixes...)
+			entry.Lenitions = append(entry.Lenitions, analysis.lenitions...)
+			for _, infix := range analysis.infixes {
+				entry.Infixes = append(entry.Infixes, infix.text)
+			}
+
+			if !slices.ContainsFunc(res, func(e DictionaryEntry) bool { return sameAnalysis(&e, &entry) }) {
+				res = append(res, entry)
+				bestCount = analysis.affixCount()
+			}
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, ErrDictionaryEntryNotFound
+	}
+
+	return res, nil
+}
+
+type morphAnalysis struct {
+	stem      string
+	prefixes  []string
+	suffixes  []string
+	lenitions []string
+	infixes   []morphInfix
+}
+
+type morphInfix struct {
+	text string
+	slot int
+	// position is the rune position in the stem.
+	position int
+}
+
+func (a *morphAnalysis) affixCount() int {
+	return len(a.prefixes) + len(a.suffixes) + len(a.lenitions) + len(a.infixes)
+}
+
+// fits checks that the infixes are in the right places for the entry. A verb without InfixIndexes cannot
+// take any, since there is no telling where they should be.
+func (a *morphAnalysis) fits(entry *DictionaryEntry) bool {
+	if len(a.infixes) == 0 {
+		return true
+	}
+	if !entry.IsVerb() {
+		return false
+	}
+
+	var slotPositions []int
+	switch len(entry.InfixIndexes) {
+	case 2:
+		slotPositions = []int{entry.InfixIndexes[0], entry.InfixIndexes[0], entry.InfixIndexes[1]}
+	case 3:
+		slotPositions = entry.InfixIndexes
+	default:
+		return false
+	}
+
+	for _, infix := range a.infixes {
+		if slotPositions[infix.slot] != infix.position {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameAnalysis(a, b *DictionaryEntry) bool {
+	return a.ID == b.ID &&
+		slices.Equal(a.Prefixes, b.Prefixes) &&
+		slices.Equal(a.Infixes, b.Infixes) &&
+		slices.Equal(a.Suffixes, b.Suffixes) &&
+		slices.Equal(a.Lenitions, b.Lenitions)
+}
+
+// analyseWord lists the ways the word could be taken apart, ordered by how many affixes it has.
+func analyseWord(word string) []morphAnalysis {
+	res := make([]morphAnalysis, 0, 32)
+	for _, suffixed := range stripMorphSuffixes(morphAnalysis{stem: word}, 0) {
+		for _, prefixed := range stripMorphPrefixes(suffixed, 0) {
+			res = append(res, prefixed)
+			res = append(res, removeMorphInfixes(prefixed)...)
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b morphAnalysis) int {
+		return a.affixCount() - b.affixCount()
+	})
+
+	return res
+}
+
+func stripMorphSuffixes(analysis morphAnalysis, depth int) []morphAnalysis {
+	res := []morphAnalysis{analysis}
+	if depth == 3 {
+		return res
+	}
+
+	for _, suffix := range morphSuffixes {
+		stem, found := strings.CutSuffix(analysis.stem, suffix.text)
+		if !found || utf8.RuneCountInString(stem) < 2 || !suffix.allows(stem) {
+			continue
+		}
+
+		next := analysis
+		next.stem = stem
+		next.suffixes = append([]string{suffix.text}, analysis.suffixes...)
+		res = append(res, stripMorphSuffixes(next, depth+1)...)
+	}
+
+	return res
+}
+
+func stripMorphPrefixes(analysis morphAnalysis, depth int) []morphAnalysis {
+	res := make([]morphAnalysis, 0, 4)
+	if depth == 0 {
+		res = append(res, analysis)
+		// The short plural is lenition without a prefix.
+		res = append(res, reverseLenition(analysis)...)
+	}
+	if depth == 2 {
+		return res
+	}
+
+	for _, prefix := range morphPrefixes {
+		stem, found := strings.CutPrefix(analysis.stem, prefix.text)
+		if !found || utf8.RuneCountInString(stem) < 2 {
+			continue
+		}
+
+		next := analysis
+		next.stem = stem
+		next.prefixes = append(append(analysis.prefixes[:0:0], analysis.prefixes...), prefix.text)
+
+		res = append(res, next)
+		if prefix.lenites {
+			res = append(res, reverseLenition(next)...)
+		}
+		res = append(res, stripMorphPrefixes(next, depth+1)...)
+	}
+
+	return res
+}
+
+// reverseLenition gives the stems that would have lenited into the analysis' stem.
+func reverseLenition(analysis morphAnalysis) []morphAnalysis {
+	res := make([]morphAnalysis, 0, 2)
+	for _, lenition := range morphLenitions {
+		if lenition[1] == "" {
+			first, _ := utf8.DecodeRuneInString(analysis.stem)
+			if !isMorphVowel(first) {
+				continue
+			}
+		} else if !strings.HasPrefix(analysis.stem, lenition[1]) {
+			continue
+		}
+
+		next := analysis
+		next.stem = lenition[0] + analysis.stem[len(lenition[1]):]
+		next.lenitions = append(analysis.lenitions[:0:0], lenition[0]+"→"+lenition[1])
+		res = append(res, next)
+	}
+
+	return res
+}
+
+// removeMorphInfixes takes out the infixes of each position, where the pre-first infix must be right in front of
+// the first and the second infix must come after them.
+func removeMorphInfixes(analysis morphAnalysis) []morphAnalysis {
+	type occurrence struct {
+		text  string
+		slot  int
+		start int
+	}
+
+	occurrences := make([]occurrence, 0, 8)
+	for slot, infixes := range morphInfixes {
+		for _, infix := range infixes {
+			for start := 1; start < len(analysis.stem); start++ {
+				if strings.HasPrefix(analysis.stem[start:], infix) {
+					occurrences = append(occurrences, occurrence{text: infix, slot: slot, start: start})
+				}
+			}
+		}
+	}
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	res := make([]morphAnalysis, 0, 4)
+	var pick func(chosen []occurrence, slot int)
+	pick = func(chosen []occurrence, slot int) {
+		if slot == len(morphInfixes) {
+			if len(chosen) == 0 {
+				return
+			}
+
+			next := analysis
+			next.infixes = make([]morphInfix, 0, len(chosen))
+			sb := strings.Builder{}
+			removed := 0
+			last := 0
+			for _, o := range chosen {
+				sb.WriteString(analysis.stem[last:o.start])
+				position := utf8.RuneCountInString(analysis.stem[:o.start]) - removed
+				next.infixes = append(next.infixes, morphInfix{text: o.text, slot: o.slot, position: position})
+				removed += utf8.RuneCountInString(o.text)
+				last = o.start + len(o.text)
+			}
+			sb.WriteString(analysis.stem[last:])
+			next.stem = sb.String()
+
+			res = append(res, next)
+			return
+		}
+
+		pick(chosen, slot+1)
+		for _, o := range occurrences {
+			if o.slot != slot {
+				continue
+			}
+			if len(chosen) > 0 {
+				previous := chosen[len(chosen)-1]
+				previousEnd := previous.start + len(previous.text)
+				if previous.slot == 0 && slot == 1 && o.start != previousEnd {
+					continue
+				}
+				if o.start < previousEnd {
+					continue
+				}
+			}
+
+			pick(append(chosen[:len(chosen):len(chosen)], o), slot+1)
+		}
+	}
+	pick(nil, 0)
+
+	return res
+}
+
+type morphSuffix struct {
+	text string
+	// after is 'v' if the suffix only goes after vowels, 'c' if it only goes after consonants.
+	after byte
+}
+
+func (s morphSuffix) allows(stem string) bool {
+	switch s.after {
+	case 'v':
+		return endsInMorphVowel(stem)
+	case 'c':
+		return !endsInMorphVowel(stem)
+	default:
+		return true
+	}
+}
+
+type morphPrefix struct {
+	text    string
+	lenites bool
+}
+
+// morphSuffixes are the case suffixes with their allomorphs, as found in suffixAliases, and other common suffixes.
+var morphSuffixes = []morphSuffix{
+	{"l", 'v'}, {"ìl", 'c'},
+	{"t", 'v'}, {"ti", 0}, {"it", 'c'},
+	{"r", 'v'}, {"ru", 'v'}, {"ur", 'c'},
+	{"yä", 'v'}, {"ä", 0},
+	{"ri", 'v'}, {"ìri", 'c'},
+	{"pe", 0}, {"o", 0}, {"sì", 0}, {"a", 0}, {"yu", 0}, {"tswo", 0}, {"tsyìp", 0}, {"fkeyk", 0},
+	{"mì", 0}, {"ro", 0}, {"ne", 0}, {"ìlä", 0}, {"ftu", 0}, {"kip", 0}, {"teri", 0}, {"fa", 0}, {"hu", 0},
+	{"sre", 0}, {"pxaw", 0}, {"ta", 0}, {"na", 0}, {"lisre", 0}, {"luke", 0}, {"mungwrr", 0}, {"pximaw", 0},
+	{"wä", 0}, {"äo", 0}, {"io", 0}, {"to", 0}, {"takip", 0}, {"talun", 0},
+}
+
+var morphPrefixes = []morphPrefix{
+	{"ay", true}, {"me", true}, {"pxe", true}, {"fay", true}, {"tsay", true}, {"pay", true}, {"pe", true},
+	{"fì", false}, {"tsa", false}, {"fra", false}, {"tì", false}, {"sä", false}, {"nì", false},
+	{"le", false}, {"a", false}, {"ke", false}, {"tsuk", false}, {"ketsuk", false}, {"fne", false},
+}
+
+// morphLenitions are the lenitions as the original and the lenited form. The longest originals come first, and a
+// lost ' is found by the word starting with a vowel.
+var morphLenitions = [][2]string{
+	{"px", "p"}, {"tx", "t"}, {"kx", "k"}, {"ts", "s"},
+	{"p", "f"}, {"t", "s"}, {"k", "h"}, {"'", ""},
+}
+
+// morphInfixes are the infixes of the pre-first, first and second positions.
+var morphInfixes = [3][]string{
+	{"äpeyk", "äp", "eyk"},
+	{
+		"am", "ìm", "ìy", "ay", "ìsy", "asy", "alm", "ìlm", "ìly", "aly", "arm", "ìrm", "ìry", "ary", "er", "ol",
+		"us", "awn", "iv", "ilv", "irv", "imv", "ìyev", "iyev", "ìmv",
+	},
+	{"ei", "eiy", "äng", "eng", "uy", "ats"},
+}
+
+func isMorphVowel(r rune) bool {
+	return strings.ContainsRune("aäeiìouù", r)
+}
+
+func endsInMorphVowel(word string) bool {
+	last, _ := utf8.DecodeLastRuneInString(word)
+	if isMorphVowel(last) {
+		return true
+	}
+
+	for _, ending := range []string{"aw", "ay", "ew", "ey", "rr", "ll"} {
+		if strings.HasSuffix(word, ending) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeMorphologyWord(word string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(word)), "’", "'")
+}
@@ -0,0 +1,73 @@
+package sarfya
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var morphologyTestDict = testDictionary{
+	"fpom":   wordFpom,
+	"uvan":   dummyDict["uvan"],
+	"krr":    DictionaryEntry{ID: "880", Word: "krr", PoS: "n.", Definitions: map[string]string{"en": "time"}},
+	"tute":   DictionaryEntry{ID: "2376", Word: "tute", PoS: "n.", Definitions: map[string]string{"en": "person"}},
+	"taron":  DictionaryEntry{ID: "2180", Word: "taron", PoS: "vtr.", Definitions: map[string]string{"en": "hunt"}, InfixIndexes: []int{1, 3}},
+	"'eylan": DictionaryEntry{ID: "176", Word: "'eylan", PoS: "n.", Definitions: map[string]string{"en": "friend"}},
+	"kame":   DictionaryEntry{ID: "812", Word: "kame", PoS: "vtr.", Definitions: map[string]string{"en": "see"}},
+}
+
+func TestWithMorphology(t *testing.T) {
+	table := []struct {
+		Search    string
+		ID        string
+		Prefixes  []string
+		Infixes   []string
+		Suffixes  []string
+		Lenitions []string
+	}{
+		{"uvan", "2644", nil, nil, nil, nil},
+		{"fpomit", "569", nil, nil, []string{"it"}, nil},
+		{"Uvanìl", "2644", nil, nil, []string{"ìl"}, nil},
+		{"ayuvanur", "2644", []string{"ay"}, nil, []string{"ur"}, nil},
+		{"hrr", "880", nil, nil, nil, []string{"k→h"}},
+		{"sute", "2376", nil, nil, nil, []string{"t→s"}},
+		{"aysutel", "2376", []string{"ay"}, nil, []string{"l"}, []string{"t→s"}},
+		{"ayeylanä", "176", []string{"ay"}, nil, []string{"ä"}, []string{"'→"}},
+		{"tamaron", "2180", nil, []string{"am"}, nil, nil},
+		{"tolareion", "2180", nil, []string{"ol", "ei"}, nil, nil},
+		{"täpolaron", "2180", nil, []string{"äp", "ol"}, nil, nil},
+		{"tìtusaron", "2180", []string{"tì"}, []string{"us"}, nil, nil},
+		{"kame", "812", nil, nil, nil, nil},
+	}
+
+	dictionary := WithMorphology(morphologyTestDict)
+	for _, tt := range table {
+		t.Run(tt.Search, func(t *testing.T) {
+			res, err := dictionary.Lookup(context.Background(), tt.Search, false)
+			if !assert.NoError(t, err) || !assert.Len(t, res, 1) {
+				return
+			}
+
+			assert.Equal(t, tt.ID, res[0].ID)
+			assert.Equal(t, tt.Prefixes, nilIfEmpty(res[0].Prefixes))
+			assert.Equal(t, tt.Infixes, nilIfEmpty(res[0].Infixes))
+			assert.Equal(t, tt.Suffixes, nilIfEmpty(res[0].Suffixes))
+			assert.Equal(t, tt.Lenitions, nilIfEmpty(res[0].Lenitions))
+		})
+	}
+
+	for _, search := range []string{"uvanl", "taramon", "fpomti'", "ayfpo", "kolame", "kameie"} {
+		t.Run(search, func(t *testing.T) {
+			_, err := dictionary.Lookup(context.Background(), search, false)
+			assert.ErrorIs(t, err, ErrDictionaryEntryNotFound)
+		})
+	}
+}
+
+func nilIfEmpty(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+
+	return list
+}
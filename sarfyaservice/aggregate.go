@@ -0,0 +1,209 @@
+package sarfyaservice
+
+import (
+	"context"
+	"errors"
+	"github.com/gissleh/sarfya"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidAggregateGroup = errors.New("the aggregate group is not valid")
+
+type AggregateRequest struct {
+	Filter  string         `json:"filter"`
+	GroupBy AggregateGroup `json:"groupBy"`
+}
+
+type AggregateResult struct {
+	// Total is the number of examples that matched. The counts can add up to more than that, since
+	// an example can be in several groups, e.g. with multiple flags or matched entries.
+	Total  int              `json:"total"`
+	Counts []AggregateCount `json:"counts"`
+}
+
+type AggregateCount struct {
+	Key   string `json:"key"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// AggregateGroup is what Service.Aggregate counts the matching examples by.
+type AggregateGroup string
+
+const (
+	// AGSource counts by the source ID, labeled by the title.
+	AGSource AggregateGroup = "source"
+	// AGYear counts by the year of the source's date.
+	AGYear AggregateGroup = "year"
+	// AGFlag counts by each flag. Examples without flags have an empty key.
+	AGFlag AggregateGroup = "flag"
+	// AGEntry counts by each dictionary entry that was matched.
+	AGEntry AggregateGroup = "entry"
+	// AGAffixes counts by each combination of a matched entry and the affixes it was used with.
+	AGAffixes AggregateGroup = "affixes"
+)
+
+func (g AggregateGroup) Valid() bool {
+	switch g {
+	case AGSource, AGYear, AGFlag, AGEntry, AGAffixes:
+		return true
+	default:
+		return false
+	}
+}
+
+// Aggregate counts the examples matching the filter by the group. Unlike QueryExample, it has no limit on
+// the number of matches. The counts are ordered by the highest count first, except for AGYear where they
+// are in chronological order.
+//
+// If the context is done before all examples have been checked, the counts so far are returned along with a
+// *PartialResultError.
+func (s *Service) Aggregate(ctx context.Context, req AggregateRequest) (*AggregateResult, error) {
+	if !req.GroupBy.Valid() {
+		return nil, ErrInvalidAggregateGroup
+	}
+
+	filter, candidates, err := sarfya.ParseFilter(ctx, req.Filter, s.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	examples, err := s.Storage.FetchExamples(ctx, filter, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	// The labels come from the first example in each group, so they should not depend on the storage's order.
+	sort.Slice(examples, func(i, j int) bool {
+		return examples[i].ID < examples[j].ID
+	})
+
+	groups := make([][]AggregateCount, len(examples))
+	checked := s.forEachIndex(ctx, len(examples), func(i int) error {
+		spans, entries, ok := filter.MatchExample(ctx, &examples[i], candidates)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ok {
+			groups[i] = aggregateGroups(req.GroupBy, &examples[i], spans, entries)
+		}
+
+		return nil
+	})
+
+	res := &AggregateResult{Counts: make([]AggregateCount, 0, 16)}
+	countIndices := make(map[string]int, 16)
+	for _, exampleGroups := range groups {
+		if exampleGroups == nil {
+			continue
+		}
+
+		res.Total += 1
+		for _, group := range exampleGroups {
+			index, ok := countIndices[group.Key]
+			if !ok {
+				index = len(res.Counts)
+				countIndices[group.Key] = index
+				res.Counts = append(res.Counts, group)
+			}
+
+			res.Counts[index].Count += 1
+		}
+	}
+
+	sort.Slice(res.Counts, func(i, j int) bool {
+		if req.GroupBy != AGYear && res.Counts[i].Count != res.Counts[j].Count {
+			return res.Counts[i].Count > res.Counts[j].Count
+		}
+
+		return res.Counts[i].Key < res.Counts[j].Key
+	})
+
+	if checked < len(examples) {
+		return res, &PartialResultError{Checked: checked, Total: len(examples), Err: ctx.Err()}
+	}
+
+	return res, nil
+}
+
+// aggregateGroups lists the groups a matched example belongs to, without duplicates and with zero counts.
+func aggregateGroups(groupBy AggregateGroup, example *sarfya.Example, spans [][]int, entries []sarfya.DictionaryEntry) []AggregateCount {
+	res := make([]AggregateCount, 0, 4)
+	add := func(key, label string) {
+		if !slices.ContainsFunc(res, func(c AggregateCount) bool { return c.Key == key }) {
+			res = append(res, AggregateCount{Key: key, Label: label})
+		}
+	}
+
+	switch groupBy {
+	case AGSource:
+		add(example.Source.ID, example.Source.Title)
+	case AGYear:
+		year := example.Source.Date
+		if len(year) > 4 {
+			year = year[:4]
+		}
+
+		add(year, "")
+	case AGFlag:
+		if len(example.Flags) == 0 {
+			add("", "")
+		}
+		for _, flag := range example.Flags {
+			add(string(flag), "")
+		}
+	case AGEntry:
+		for _, entry := range entries {
+			add(entry.ID, entry.Word)
+		}
+	case AGAffixes:
+		seen := make(map[int]bool, 8)
+		for _, span := range spans {
+			for _, index := range span {
+				for _, id := range example.Text[index].IDs {
+					if seen[id] {
+						continue
+					}
+					seen[id] = true
+
+					for _, word := range example.Words[id] {
+						if slices.ContainsFunc(entries, func(e sarfya.DictionaryEntry) bool { return e.ID == word.ID }) {
+							label := affixLabel(&word)
+							add(word.ID+":"+label, label)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// affixLabel shows the word with its affixes, like `fì- fpom -ti` or `taron <ol>`.
+func affixLabel(entry *sarfya.DictionaryEntry) string {
+	sb := strings.Builder{}
+	for _, prefix := range entry.Prefixes {
+		sb.WriteString(prefix)
+		sb.WriteString("- ")
+	}
+	for _, lenition := range entry.Lenitions {
+		sb.WriteString("(")
+		sb.WriteString(lenition)
+		sb.WriteString(") ")
+	}
+	sb.WriteString(entry.Word)
+	for _, infix := range entry.Infixes {
+		sb.WriteString(" <")
+		sb.WriteString(infix)
+		sb.WriteString(">")
+	}
+	for _, suffix := range entry.Suffixes {
+		sb.WriteString(" -")
+		sb.WriteString(suffix)
+	}
+
+	return sb.String()
+}
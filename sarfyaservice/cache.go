@@ -0,0 +1,227 @@
+package sarfyaservice
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+
+	"github.com/gissleh/sarfya"
+)
+
+// ResultCache is an LRU cache of query results for Service. The keys are the canonical form of the
+// filter, so `uvan+a` and `uvan + a` share an entry. It is cleared whenever the service saves or deletes
+// an example.
+//
+// The sizes are estimates of the memory the results use, and not exact.
+type ResultCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	entries    map[string]*list.Element
+	order      *list.List
+	stats      CacheStats
+	generation uint64
+}
+
+// NewResultCache creates a cache that holds up to maxEntries results, and up to maxBytes of them by their
+// estimated size. Either limit is ignored if it is zero or less.
+func NewResultCache(maxEntries int, maxBytes int64) *ResultCache {
+	return &ResultCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element, 64),
+		order:      list.New(),
+	}
+}
+
+// Stats gives the hit and miss counts since the cache was created, and its current size.
+func (c *ResultCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// Clear removes all results. The hit and miss counts are kept.
+func (c *ResultCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.order.Init()
+	c.generation += 1
+	c.stats.Entries = 0
+	c.stats.Bytes = 0
+}
+
+// currentGeneration is changed by every Clear. Results should be put with the generation from before they
+// were computed, so that a query running alongside a change does not put back a stale result.
+func (c *ResultCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *ResultCache) get(key string) (any, bool) {
+	return c.lookup(key, true)
+}
+
+// getOrFallBack is like get, but does not count a miss, for when the caller falls back to another lookup that
+// will count it instead.
+func (c *ResultCache) getOrFallBack(key string) (any, bool) {
+	return c.lookup(key, false)
+}
+
+func (c *ResultCache) lookup(key string, countMiss bool) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		if countMiss {
+			c.stats.Misses += 1
+		}
+		return nil, false
+	}
+
+	c.stats.Hits += 1
+	c.order.MoveToFront(element)
+	return element.Value.(*resultCacheEntry).value, true
+}
+
+func (c *ResultCache) put(key string, value any, size int64, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	// A result that would push everything else out is not worth keeping.
+	if c.maxBytes > 0 && size > c.maxBytes/2 {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&resultCacheEntry{key: key, value: value, size: size})
+	c.stats.Entries += 1
+	c.stats.Bytes += size
+
+	for (c.maxEntries > 0 && c.stats.Entries > c.maxEntries) || (c.maxBytes > 0 && c.stats.Bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+		c.stats.Evictions += 1
+	}
+}
+
+func (c *ResultCache) remove(element *list.Element) {
+	entry := element.Value.(*resultCacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.stats.Entries -= 1
+	c.stats.Bytes -= entry.size
+}
+
+type resultCacheEntry struct {
+	key   string
+	value any
+	size  int64
+}
+
+// CacheStats count one hit or miss per query. QueryExampleCompact is a hit if either its own result or the
+// matches it is made from are cached.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// estimateMatchesSize estimates the memory used by the matches. Most of it is in the example's text, the
+// words and the translations, so the rest is covered by a flat overhead per match.
+func estimateMatchesSize(matches []sarfya.FilterMatch) int64 {
+	size := int64(0)
+	for _, match := range matches {
+		size += 512 + estimateSentenceSize(match.Text)
+		for _, translation := range match.Translations {
+			size += estimateSentenceSize(translation)
+		}
+		for _, words := range match.Words {
+			size += int64(len(words)) * 384
+		}
+		for _, text := range match.WordMap {
+			size += 32 + int64(len(text))
+		}
+	}
+
+	return size
+}
+
+// copyCompactGroups copies the groups down to the lines of chunks, so that the caller can change them without
+// changing the cached result.
+func copyCompactGroups(groups []FilterMatchGroupCompact) []FilterMatchGroupCompact {
+	res := make([]FilterMatchGroupCompact, 0, len(groups))
+	for _, group := range groups {
+		entries := make([]sarfya.DictionaryEntry, 0, len(group.Entries))
+		for _, entry := range group.Entries {
+			entries = append(entries, entry.Copy())
+		}
+
+		examples := make([]sarfya.FilterMatchCompact, 0, len(group.Examples))
+		for _, example := range group.Examples {
+			example.Flags = slices.Clone(example.Flags)
+			example.Navi = copyCompactLines(example.Navi)
+			example.Translation = copyCompactLines(example.Translation)
+			examples = append(examples, example)
+		}
+
+		res = append(res, FilterMatchGroupCompact{Entries: entries, Examples: examples})
+	}
+
+	return res
+}
+
+func copyCompactLines(lines [][]sarfya.FilterMatchCompactChunk) [][]sarfya.FilterMatchCompactChunk {
+	if lines == nil {
+		return nil
+	}
+
+	res := make([][]sarfya.FilterMatchCompactChunk, 0, len(lines))
+	for _, line := range lines {
+		res = append(res, slices.Clone(line))
+	}
+
+	return res
+}
+
+func estimateCompactSize(groups []FilterMatchGroupCompact) int64 {
+	size := int64(0)
+	for _, group := range groups {
+		size += int64(len(group.Entries)) * 384
+		for _, example := range group.Examples {
+			size += 256
+			for _, lines := range [][][]sarfya.FilterMatchCompactChunk{example.Navi, example.Translation} {
+				for _, line := range lines {
+					for _, chunk := range line {
+						size += 96 + int64(len(chunk.Text)+len(chunk.Link))
+					}
+				}
+			}
+		}
+	}
+
+	return size
+}
+
+func estimateSentenceSize(sentence sarfya.Sentence) int64 {
+	size := int64(0)
+	for _, part := range sentence {
+		size += 96 + int64(len(part.Text)+len(part.HiddenText)+len(part.IDs)*8)
+	}
+
+	return size
+}
@@ -0,0 +1,125 @@
+package sarfyaservice
+
+import (
+	"context"
+	"github.com/gissleh/sarfya"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResultCache_Eviction(t *testing.T) {
+	cache := NewResultCache(2, 0)
+	cache.put("a", 1, 10, 0)
+	cache.put("b", 2, 10, 0)
+	_, _ = cache.get("a")
+	cache.put("c", 3, 10, 0)
+
+	_, ok := cache.get("b")
+	assert.False(t, ok)
+	value, ok := cache.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Evictions: 1, Entries: 2, Bytes: 20}, cache.Stats())
+
+	cache = NewResultCache(0, 100)
+	cache.put("a", 1, 40, 0)
+	cache.put("b", 2, 40, 0)
+	cache.put("c", 3, 40, 0)
+	cache.put("d", 4, 60, 0)
+
+	_, ok = cache.get("a")
+	assert.False(t, ok)
+	_, ok = cache.get("d")
+	assert.False(t, ok)
+	assert.Equal(t, CacheStats{Misses: 2, Evictions: 1, Entries: 2, Bytes: 80}, cache.Stats())
+}
+
+func TestResultCache_Generation(t *testing.T) {
+	cache := NewResultCache(0, 0)
+	generation := cache.currentGeneration()
+	cache.put("a", 1, 10, generation)
+	cache.Clear()
+	cache.put("b", 2, 10, generation)
+
+	_, ok := cache.get("a")
+	assert.False(t, ok)
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+
+	cache.put("b", 2, 10, cache.currentGeneration())
+	_, ok = cache.get("b")
+	assert.True(t, ok)
+}
+
+func TestService_Cache(t *testing.T) {
+	service := newTestService(t)
+	service.Cache = NewResultCache(16, 0)
+	countMatches := func(filter string) int {
+		groups, err := service.QueryExample(context.Background(), filter)
+		if !assert.NoError(t, err) {
+			return -1
+		}
+
+		res := 0
+		for _, group := range groups {
+			res += len(group.Examples)
+		}
+
+		return res
+	}
+
+	assert.Equal(t, 2, countMatches("uvan"))
+	assert.Equal(t, 2, countMatches("uvan"))
+	stats := service.Cache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Greater(t, stats.Bytes, int64(0))
+
+	_, err := service.SaveExample(context.Background(), sarfya.Input{
+		ID:     "test-0005",
+		Text:   "1Uvan.",
+		Source: sarfya.Source{ID: "test", Date: "2024-01-02", URL: "https://example.com"},
+	}, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, service.Cache.Stats().Entries)
+	assert.Equal(t, 3, countMatches("uvan"))
+
+	_, err = service.DeleteExample(context.Background(), "test-0005")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, service.Cache.Stats().Entries)
+	assert.Equal(t, 2, countMatches("uvan"))
+
+	// A compact result counts once, whether it or the matches it is made from are cached.
+	service.Cache = NewResultCache(16, 0)
+	_, err = service.QueryExampleCompact(context.Background(), "uvan", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, CacheStats{Misses: 1, Entries: 2, Bytes: service.Cache.Stats().Bytes}, service.Cache.Stats())
+	res, err := service.QueryExampleCompact(context.Background(), "uvan", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countMatches("oe"))
+	_, err = service.QueryExampleCompact(context.Background(), "oe", "en")
+	assert.NoError(t, err)
+	stats = service.Cache.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 4, stats.Entries)
+
+	// Changing a compact result does not change the cached one.
+	if assert.Len(t, res, 1) && assert.Len(t, res[0].Examples, 2) {
+		res[0].Examples[0].ID = "changed"
+		res[0].Examples[0].Navi[0][0].Text = "changed"
+		res[0].Entries[0].Word = "changed"
+		res[0].Examples = res[0].Examples[:1]
+	}
+	res2, err := service.QueryExampleCompact(context.Background(), "uvan", "en")
+	if assert.NoError(t, err) && assert.Len(t, res2, 1) && assert.Len(t, res2[0].Examples, 2) {
+		assert.NotEqual(t, "changed", res2[0].Examples[0].ID)
+		assert.NotEqual(t, "changed", res2[0].Examples[0].Navi[0][0].Text)
+		assert.Equal(t, "uvan", res2[0].Entries[0].Word)
+	}
+}
@@ -0,0 +1,115 @@
+package sarfyaservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gissleh/sarfya"
+)
+
+const DefaultQueryLimit = 100
+const MaxQueryLimit = 2000
+
+var ErrInvalidCursor = errors.New("the cursor is not valid for this query")
+var ErrInvalidSort = errors.New("the sort order is not valid")
+
+type QueryRequest struct {
+	Filter string    `json:"filter"`
+	Sort   QuerySort `json:"sort,omitempty"`
+	// Limit is the number of examples per page. It defaults to DefaultQueryLimit, and cannot be
+	// more than MaxQueryLimit.
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type QueryResult struct {
+	Groups []FilterMatchGroup `json:"groups"`
+	// Total is the number of examples that matched across all pages.
+	Total      int    `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// QuerySort is the order of the examples within each group of a query's result.
+type QuerySort string
+
+const (
+	QSNewest QuerySort = ""
+	QSOldest QuerySort = "oldest"
+	QSSource QuerySort = "source"
+	QSText   QuerySort = "text"
+	QSSpans  QuerySort = "spans"
+)
+
+func (s QuerySort) Valid() bool {
+	switch s {
+	case QSNewest, QSOldest, QSSource, QSText, QSSpans:
+		return true
+	default:
+		return false
+	}
+}
+
+// less compares the matches by the sort order, falling back to Example.ListBefore and then the ID so
+// that the pages are stable.
+func (s QuerySort) less(a, b *sarfya.FilterMatch) bool {
+	switch s {
+	case QSOldest:
+		if a.Example.Source.Date != b.Example.Source.Date {
+			return a.Example.Source.Date < b.Example.Source.Date
+		}
+	case QSSource:
+		if a.Example.Source.Title != b.Example.Source.Title {
+			return a.Example.Source.Title < b.Example.Source.Title
+		}
+		if a.Example.Source.ID != b.Example.Source.ID {
+			return a.Example.Source.ID < b.Example.Source.ID
+		}
+	case QSText:
+		aText := a.Example.Text.RawText()
+		bText := b.Example.Text.RawText()
+		if aText != bText {
+			return aText < bText
+		}
+	case QSSpans:
+		if len(a.Spans) != len(b.Spans) {
+			return len(a.Spans) > len(b.Spans)
+		}
+	}
+
+	if a.Example.ListBefore(&b.Example) {
+		return true
+	} else if b.Example.ListBefore(&a.Example) {
+		return false
+	}
+
+	return a.Example.ID < b.Example.ID
+}
+
+type queryCursorData struct {
+	Offset int       `json:"o"`
+	Filter string    `json:"f"`
+	Sort   QuerySort `json:"s,omitempty"`
+}
+
+func queryCursor(offset int, filter string, sort QuerySort) string {
+	data, _ := json.Marshal(queryCursorData{Offset: offset, Filter: filter, Sort: sort})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseQueryCursor gives the offset of the cursor, which must have been made for the same filter and sort order.
+func parseQueryCursor(cursor string, filter string, sort QuerySort) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	var cursorData queryCursorData
+	if err := json.Unmarshal(data, &cursorData); err != nil {
+		return 0, ErrInvalidCursor
+	}
+	if cursorData.Offset < 0 || cursorData.Filter != filter || cursorData.Sort != sort {
+		return 0, ErrInvalidCursor
+	}
+
+	return cursorData.Offset, nil
+}
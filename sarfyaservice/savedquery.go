@@ -0,0 +1,116 @@
+package sarfyaservice
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/gissleh/sarfya"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrSavedQueriesNotSupported = errors.New("saved queries are not supported by this service")
+
+// CreateSavedQuery stores the query with a new ID and the current time. The filter is checked against the
+// dictionary, and stored in its canonical form.
+func (s *Service) CreateSavedQuery(ctx context.Context, query sarfya.SavedQuery) (*sarfya.SavedQuery, error) {
+	if s.ReadOnly {
+		return nil, sarfya.ErrReadOnly
+	}
+	if s.SavedQueries == nil {
+		return nil, ErrSavedQueriesNotSupported
+	}
+
+	query.Name = strings.TrimSpace(query.Name)
+	if query.Name == "" {
+		return nil, errors.New("missing name in saved query")
+	}
+
+	filter, _, err := sarfya.ParseFilter(ctx, query.Filter, s.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Root == nil {
+		return nil, errors.New("missing filter in saved query")
+	}
+
+	id := uuid.New()
+	query.ID = base64.RawURLEncoding.EncodeToString(id[:])
+	query.Filter = filter.String()
+	query.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	err = s.SavedQueries.SaveSavedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &query, nil
+}
+
+func (s *Service) FindSavedQuery(ctx context.Context, id string) (*sarfya.SavedQuery, error) {
+	if s.SavedQueries == nil {
+		return nil, ErrSavedQueriesNotSupported
+	}
+
+	return s.SavedQueries.FindSavedQuery(ctx, id)
+}
+
+// ListSavedQueries lists the saved queries by name. If owner is set, only their queries are listed.
+func (s *Service) ListSavedQueries(ctx context.Context, owner string) ([]sarfya.SavedQuery, error) {
+	if s.SavedQueries == nil {
+		return nil, ErrSavedQueriesNotSupported
+	}
+
+	queries, err := s.SavedQueries.ListSavedQueries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]sarfya.SavedQuery, 0, len(queries))
+	for _, query := range queries {
+		if owner == "" || query.Owner == owner {
+			res = append(res, query)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name == res[j].Name {
+			return res[i].ID < res[j].ID
+		}
+
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// RunSavedQuery runs the saved query's filter like QueryExample.
+func (s *Service) RunSavedQuery(ctx context.Context, id string) (*sarfya.SavedQuery, []FilterMatchGroup, error) {
+	query, err := s.FindSavedQuery(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups, err := s.QueryExample(ctx, query.Filter)
+	return query, groups, err
+}
+
+func (s *Service) DeleteSavedQuery(ctx context.Context, id string) (*sarfya.SavedQuery, error) {
+	if s.ReadOnly {
+		return nil, sarfya.ErrReadOnly
+	}
+
+	query, err := s.FindSavedQuery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.SavedQueries.DeleteSavedQuery(ctx, *query)
+	if err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
@@ -0,0 +1,149 @@
+package sarfyaservice
+
+import (
+	"context"
+	"github.com/gissleh/sarfya"
+	"github.com/gissleh/sarfya/adapters/jsonstorage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newSavedQueryTestService(t *testing.T) *Service {
+	service := newTestService(t)
+	service.SavedQueries = service.Storage.(*jsonstorage.Storage)
+
+	return service
+}
+
+func TestService_SavedQueries(t *testing.T) {
+	service := newSavedQueryTestService(t)
+	ctx := context.Background()
+
+	created, err := service.CreateSavedQuery(ctx, sarfya.SavedQuery{Name: " Games ", Filter: "uvan+oe", Owner: "a"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "Games", created.Name)
+	assert.Equal(t, "uvan + oe", created.Filter)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	other, err := service.CreateSavedQuery(ctx, sarfya.SavedQuery{Name: "Being", Filter: "lu", Owner: "b"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEqual(t, created.ID, other.ID)
+
+	found, err := service.FindSavedQuery(ctx, created.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, created, found)
+	}
+
+	listed, err := service.ListSavedQueries(ctx, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sarfya.SavedQuery{*other, *created}, listed)
+	}
+	listed, err = service.ListSavedQueries(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sarfya.SavedQuery{*created}, listed)
+	}
+	listed, err = service.ListSavedQueries(ctx, "c")
+	if assert.NoError(t, err) {
+		assert.Empty(t, listed)
+	}
+
+	query, groups, err := service.RunSavedQuery(ctx, other.ID)
+	if assert.NoError(t, err) {
+		expected, err := service.QueryExample(ctx, "lu")
+		assert.NoError(t, err)
+		assert.Equal(t, other, query)
+		assert.Equal(t, expected, groups)
+	}
+
+	deleted, err := service.DeleteSavedQuery(ctx, created.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, created, deleted)
+	}
+	_, err = service.FindSavedQuery(ctx, created.ID)
+	assert.ErrorIs(t, err, sarfya.ErrSavedQueryNotFound)
+	_, _, err = service.RunSavedQuery(ctx, created.ID)
+	assert.ErrorIs(t, err, sarfya.ErrSavedQueryNotFound)
+	_, err = service.DeleteSavedQuery(ctx, created.ID)
+	assert.ErrorIs(t, err, sarfya.ErrSavedQueryNotFound)
+	listed, err = service.ListSavedQueries(ctx, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sarfya.SavedQuery{*other}, listed)
+	}
+}
+
+func TestService_CreateSavedQuery_Errors(t *testing.T) {
+	service := newSavedQueryTestService(t)
+
+	table := []struct {
+		Name  string
+		Query sarfya.SavedQuery
+		Error string
+	}{
+		{"name", sarfya.SavedQuery{Name: " ", Filter: "lu"}, "missing name in saved query"},
+		{"filter", sarfya.SavedQuery{Name: "Empty", Filter: ""}, "missing filter in saved query"},
+		{"global terms only", sarfya.SavedQuery{Name: "Source", Filter: "src:a"}, "missing filter in saved query"},
+	}
+
+	for _, row := range table {
+		t.Run(row.Name, func(t *testing.T) {
+			_, err := service.CreateSavedQuery(context.Background(), row.Query)
+			assert.EqualError(t, err, row.Error)
+		})
+	}
+
+	t.Run("parse", func(t *testing.T) {
+		_, err := service.CreateSavedQuery(context.Background(), sarfya.SavedQuery{Name: "Unknown", Filter: "fpom"})
+		var parseErr sarfya.FilterParseError
+		if assert.ErrorAs(t, err, &parseErr) {
+			assert.Equal(t, "no_matched_entries", parseErr.Code)
+		}
+	})
+
+	listed, err := service.ListSavedQueries(context.Background(), "")
+	if assert.NoError(t, err) {
+		assert.Empty(t, listed)
+	}
+}
+
+func TestService_SavedQueries_ReadOnly(t *testing.T) {
+	service := newSavedQueryTestService(t)
+	ctx := context.Background()
+	created, err := service.CreateSavedQuery(ctx, sarfya.SavedQuery{Name: "Being", Filter: "lu"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	service.ReadOnly = true
+	_, err = service.CreateSavedQuery(ctx, sarfya.SavedQuery{Name: "Games", Filter: "uvan"})
+	assert.ErrorIs(t, err, sarfya.ErrReadOnly)
+	_, err = service.DeleteSavedQuery(ctx, created.ID)
+	assert.ErrorIs(t, err, sarfya.ErrReadOnly)
+
+	listed, err := service.ListSavedQueries(ctx, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []sarfya.SavedQuery{*created}, listed)
+	}
+	_, _, err = service.RunSavedQuery(ctx, created.ID)
+	assert.NoError(t, err)
+}
+
+func TestService_SavedQueries_NotSupported(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+
+	_, err := service.CreateSavedQuery(ctx, sarfya.SavedQuery{Name: "Being", Filter: "lu"})
+	assert.ErrorIs(t, err, ErrSavedQueriesNotSupported)
+	_, err = service.FindSavedQuery(ctx, "x")
+	assert.ErrorIs(t, err, ErrSavedQueriesNotSupported)
+	_, err = service.ListSavedQueries(ctx, "")
+	assert.ErrorIs(t, err, ErrSavedQueriesNotSupported)
+	_, _, err = service.RunSavedQuery(ctx, "x")
+	assert.ErrorIs(t, err, ErrSavedQueriesNotSupported)
+	_, err = service.DeleteSavedQuery(ctx, "x")
+	assert.ErrorIs(t, err, ErrSavedQueriesNotSupported)
+}
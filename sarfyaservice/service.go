@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/gissleh/sarfya"
 	"github.com/google/uuid"
+	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -15,74 +18,316 @@ type Service struct {
 	Dictionary sarfya.Dictionary
 	Storage    ExampleStorage
 	ReadOnly   bool
+
+	// SavedQueries stores the saved queries. The saved query methods return ErrSavedQueriesNotSupported
+	// if it is not set.
+	SavedQueries SavedQueryStorage
+
+	// Concurrency is the number of goroutines that check examples against the filter in each query. It
+	// defaults to runtime.GOMAXPROCS if it's zero or less.
+	Concurrency int
+	// Cache keeps the results of recent queries if it is set. Partial results are not cached.
+	Cache *ResultCache
 }
 
 func (s *Service) FindExample(ctx context.Context, id string) (*sarfya.Example, error) {
 	return s.Storage.FindExample(ctx, id)
 }
 
+// QueryExample finds all examples matching the filter, grouped by the dictionary entries that were
+// matched. The groups with the most examples come first.
+//
+// If the context is done before all examples have been checked, the groups found so far are returned along
+// with a *PartialResultError.
 func (s *Service) QueryExample(ctx context.Context, filterString string) ([]FilterMatchGroup, error) {
-	filter, resolvedMaps, err := sarfya.ParseFilter(ctx, filterString, s.Dictionary)
+	filter, candidates, err := sarfya.ParseFilter(ctx, filterString, s.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := s.findMatches(ctx, filter, candidates)
+	if err != nil && matches == nil {
+		return nil, err
+	}
+	if len(matches) > 2000 {
+		return nil, errors.New("query would have returned more than 2000 results, please be more specific")
+	}
+
+	return groupMatches(matches, QSNewest), err
+}
+
+// QueryExampleCompact is like QueryExample, but gives the groups in their compact form with the translation
+// in the language.
+func (s *Service) QueryExampleCompact(ctx context.Context, filterString string, lang string) ([]FilterMatchGroupCompact, error) {
+	filter, err := sarfya.ParseFilterString(filterString)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resolvedMaps) > 10 {
-		return nil, errors.New("you cannot have more than 10 combinations of matches, please use constraints or operators")
+	key := "compact\x00" + filter.String() + "\x00" + lang
+	generation := uint64(0)
+	if s.Cache != nil {
+		if res, ok := s.Cache.getOrFallBack(key); ok {
+			return copyCompactGroups(res.([]FilterMatchGroupCompact)), nil
+		}
+
+		generation = s.Cache.currentGeneration()
 	}
 
-	total := 0
+	groups, err := s.QueryExample(ctx, filterString)
+	if err != nil && groups == nil {
+		return nil, err
+	}
 
-	res := make([]FilterMatchGroup, 0, len(resolvedMaps))
-	for _, resolvedMap := range resolvedMaps {
-		group := FilterMatchGroup{}
+	res := make([]FilterMatchGroupCompact, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, *group.ToCompact(lang))
+	}
 
-		examples, err := s.Storage.FetchExamples(ctx, filter, resolvedMap)
+	if s.Cache != nil && err == nil {
+		s.Cache.put(key, copyCompactGroups(res), estimateCompactSize(res), generation)
+	}
+
+	return res, err
+}
+
+// Query finds a page of the examples matching the request's filter. The matches are grouped and ordered
+// like in QueryExample, and the examples within each group are ordered by the request's sort order.
+// The next page can be fetched by passing on the result's NextCursor with an otherwise identical request.
+// Every page checks all the examples again unless the service has a Cache, in which case the pages after
+// the first reuse its matches.
+//
+// If the context is done before all examples have been checked, the page is made from the matches found
+// so far and returned without a NextCursor along with a *PartialResultError.
+func (s *Service) Query(ctx context.Context, req QueryRequest) (*QueryResult, error) {
+	if !req.Sort.Valid() {
+		return nil, ErrInvalidSort
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	} else if limit > MaxQueryLimit {
+		limit = MaxQueryLimit
+	}
+
+	filter, candidates, err := sarfya.ParseFilter(ctx, req.Filter, s.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if req.Cursor != "" {
+		offset, err = parseQueryCursor(req.Cursor, filter.String(), req.Sort)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		wg := &sync.WaitGroup{}
-		matches := make([]*sarfya.FilterMatch, len(examples))
-		nextIndex := int32(-1)
-		for i := 0; i < 3; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
+	matches, err := s.findMatches(ctx, filter, candidates)
+	if err != nil && matches == nil {
+		return nil, err
+	}
+	partialErr := err
 
-				i := int(atomic.AddInt32(&nextIndex, 1))
-				for i < len(examples) {
-					matches[i] = filter.CheckExample(examples[i], resolvedMap)
-					i = int(atomic.AddInt32(&nextIndex, 1))
-				}
-			}()
+	res := &QueryResult{Groups: make([]FilterMatchGroup, 0, 4), Total: len(matches)}
+	position := 0
+	for _, group := range groupMatches(matches, req.Sort) {
+		if position+len(group.Examples) <= offset {
+			position += len(group.Examples)
+			continue
+		}
+
+		start := max(offset-position, 0)
+		end := min(len(group.Examples), offset+limit-position)
+		res.Groups = append(res.Groups, FilterMatchGroup{Entries: group.Entries, Examples: group.Examples[start:end]})
+
+		position += len(group.Examples)
+		if position >= offset+limit {
+			break
+		}
+	}
+
+	if partialErr != nil {
+		return res, partialErr
+	}
+	if offset+limit < len(matches) {
+		res.NextCursor = queryCursor(offset+limit, filter.String(), req.Sort)
+	}
+
+	return res, nil
+}
+
+// findMatches fetches the examples and checks them against the filter. If the context is done before all
+// are checked, it returns the matches so far with a *PartialResultError. The matches may come from the
+// cache, so they must not be modified.
+func (s *Service) findMatches(ctx context.Context, filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) ([]sarfya.FilterMatch, error) {
+	key := "matches\x00" + filter.String()
+	generation := uint64(0)
+	if s.Cache != nil {
+		if res, ok := s.Cache.get(key); ok {
+			return res.([]sarfya.FilterMatch), nil
 		}
-		wg.Wait()
 
-		for _, match := range matches {
-			if match != nil {
-				group.Examples = append(group.Examples, *match)
+		generation = s.Cache.currentGeneration()
+	}
 
-				total += 1
-				if total > 2000 {
-					return nil, errors.New("query would have returned more than 2000 results, please be more specific")
+	examples, err := s.Storage.FetchExamples(ctx, filter, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*sarfya.FilterMatch, len(examples))
+	checked := s.forEachIndex(ctx, len(examples), func(i int) error {
+		var err error
+		matches[i], err = filter.CheckExampleContext(ctx, examples[i], candidates)
+		return err
+	})
+
+	res := make([]sarfya.FilterMatch, 0, 16)
+	for _, match := range matches {
+		if match != nil {
+			res = append(res, *match)
+		}
+	}
+
+	if checked < len(examples) {
+		return res, &PartialResultError{Checked: checked, Total: len(examples), Err: ctx.Err()}
+	}
+
+	if s.Cache != nil {
+		s.Cache.put(key, res, estimateMatchesSize(res), generation)
+	}
+
+	return res, nil
+}
+
+// groupMatches groups the matches by the dictionary entries that were matched, with the largest groups first.
+func groupMatches(matches []sarfya.FilterMatch, sortOrder QuerySort) []FilterMatchGroup {
+	res := make([]FilterMatchGroup, 0, 4)
+	groupIndices := make(map[string]int, 4)
+	for _, match := range matches {
+		key := entriesKey(match.Entries)
+		groupIndex, ok := groupIndices[key]
+		if !ok {
+			groupIndex = len(res)
+			groupIndices[key] = groupIndex
+			res = append(res, FilterMatchGroup{Entries: match.Entries})
+		}
+
+		res[groupIndex].Examples = append(res[groupIndex].Examples, match)
+	}
+
+	for _, group := range res {
+		sort.Slice(group.Examples, func(i, j int) bool {
+			return sortOrder.less(&group.Examples[i], &group.Examples[j])
+		})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if len(res[i].Examples) == len(res[j].Examples) {
+			return entriesKey(res[i].Entries) < entriesKey(res[j].Entries)
+		}
+
+		return len(res[i].Examples) > len(res[j].Examples)
+	})
+
+	return res
+}
+
+// ExplainQuery runs the query like QueryExample, but tells how each stage went instead of returning the
+// matches. If exampleID is set, it also explains why that example did or did not match. If the context is
+// done before all examples have been checked, the explanation so far is returned with a *PartialResultError.
+func (s *Service) ExplainQuery(ctx context.Context, filterString string, exampleID string) (*QueryExplanation, error) {
+	filter, candidates, err := sarfya.ParseFilter(ctx, filterString, s.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QueryExplanation{
+		Filter:   filter.String(),
+		Terms:    make([]ExplainedTerm, 0, len(filter.Terms)),
+		FullList: filter.NeedFullList(),
+	}
+	for i, term := range filter.Terms {
+		res.Terms = append(res.Terms, ExplainedTerm{Term: term, Candidates: candidates[i]})
+	}
+	if !res.FullList {
+		for _, sets := range filter.WordLookupStrategy(candidates) {
+			setIDs := make([][]string, 0, len(sets))
+			for _, entries := range sets {
+				ids := make([]string, 0, len(entries))
+				for _, entry := range entries {
+					ids = append(ids, entry.ID)
 				}
+				setIDs = append(setIDs, ids)
 			}
+
+			res.LookupStrategy = append(res.LookupStrategy, setIDs)
 		}
-		if len(group.Examples) == 0 {
+	}
+
+	if explainer, ok := s.Storage.(FetchExplainer); ok {
+		res.IndexKeys, err = explainer.ExplainFetch(ctx, filter, candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	examples, err := s.Storage.FetchExamples(ctx, filter, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Stages = append(res.Stages, ExplainedStage{Name: "storage", Count: len(examples)})
+	explanations := make([]*sarfya.FilterExplanation, len(examples))
+	checked := s.forEachIndex(ctx, len(examples), func(i int) error {
+		explanations[i] = filter.ExplainExample(examples[i], candidates)
+		return nil
+	})
+
+	metadataCount := 0
+	matchedCount := 0
+	for i, explanation := range explanations {
+		if exampleID != "" && examples[i].ID == exampleID {
+			res.ExampleFetched = true
+		}
+		if explanation == nil || explanation.Reason != "" {
 			continue
 		}
 
-		sort.Slice(group.Examples, func(i, j int) bool {
-			return group.Examples[i].Example.ListBefore(&group.Examples[j].Example)
-		})
+		metadataCount += 1
+		if explanation.Matched {
+			matchedCount += 1
+		}
 
-		for i := range filter.Terms {
-			if entry, ok := resolvedMap[i]; ok {
-				group.Entries = append(group.Entries, entry.Copy())
+		if res.Nodes == nil {
+			res.Nodes = make([]ExplainedNode, 0, len(explanation.Nodes))
+			for _, node := range explanation.Nodes {
+				res.Nodes = append(res.Nodes, ExplainedNode{Expression: node.Expression, Depth: node.Depth})
+			}
+		}
+		for i, node := range explanation.Nodes {
+			if node.Passed {
+				res.Nodes[i].Count += 1
 			}
 		}
-		res = append(res, group)
+	}
+	res.Stages = append(res.Stages,
+		ExplainedStage{Name: "metadata", Count: metadataCount},
+		ExplainedStage{Name: "expression", Count: matchedCount},
+	)
+
+	if checked < len(examples) {
+		return res, &PartialResultError{Checked: checked, Total: len(examples), Err: ctx.Err()}
+	}
+
+	if exampleID != "" {
+		example, err := s.Storage.FindExample(ctx, exampleID)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Example = filter.ExplainExample(*example, candidates)
 	}
 
 	return res, nil
@@ -112,6 +357,10 @@ func (s *Service) SaveExample(ctx context.Context, input sarfya.Input, dry bool)
 		if err != nil {
 			return nil, err
 		}
+
+		if s.Cache != nil {
+			s.Cache.Clear()
+		}
 	}
 
 	return example, nil
@@ -132,9 +381,74 @@ func (s *Service) DeleteExample(ctx context.Context, id string) (*sarfya.Example
 		return nil, err
 	}
 
+	if s.Cache != nil {
+		s.Cache.Clear()
+	}
+
 	return example, nil
 }
 
+// forEachIndex calls the callback for every index up to length across the service's goroutines. It stops
+// when the context is done, and gives the number of callbacks that completed without an error. The callbacks
+// are called in no particular order, so they should store their results by index.
+func (s *Service) forEachIndex(ctx context.Context, length int, callback func(i int) error) int {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	concurrency = min(concurrency, length)
+
+	wg := &sync.WaitGroup{}
+	nextIndex := int32(-1)
+	completed := int32(0)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			i := int(atomic.AddInt32(&nextIndex, 1))
+			for i < length && ctx.Err() == nil {
+				if callback(i) == nil {
+					atomic.AddInt32(&completed, 1)
+				}
+				i = int(atomic.AddInt32(&nextIndex, 1))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return int(completed)
+}
+
+// PartialResultError is returned along with the results found so far when the context is done before all
+// examples have been checked, like when a request times out or the client disconnects.
+type PartialResultError struct {
+	// Checked is the number of examples that were checked.
+	Checked int
+	// Total is the number of examples that would have been checked.
+	Total int
+	// Err is the context's error.
+	Err error
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("only %d of %d examples were checked: %s", e.Checked, e.Total, e.Err)
+}
+
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
+
+func entriesKey(entries []sarfya.DictionaryEntry) string {
+	sb := strings.Builder{}
+	for _, entry := range entries {
+		sb.WriteString(entry.ID)
+		sb.WriteByte(';')
+	}
+
+	return sb.String()
+}
+
 type FilterMatchGroup struct {
 	Entries  []sarfya.DictionaryEntry `json:"entries,omitempty"`
 	Examples []sarfya.FilterMatch     `json:"examples"`
@@ -157,3 +471,41 @@ type FilterMatchGroupCompact struct {
 	Entries  []sarfya.DictionaryEntry    `json:"entries,omitempty"`
 	Examples []sarfya.FilterMatchCompact `json:"examples"`
 }
+
+// QueryExplanation is the result of Service.ExplainQuery.
+type QueryExplanation struct {
+	// Filter is the canonical form of the query.
+	Filter string          `json:"filter"`
+	Terms  []ExplainedTerm `json:"terms"`
+	// FullList is true if the storage must go through every example, e.g. because of a `*` term.
+	FullList bool `json:"fullList"`
+	// LookupStrategy is the filter's WordLookupStrategy as entry IDs.
+	LookupStrategy [][][]string `json:"lookupStrategy,omitempty"`
+	// IndexKeys are the keys the storage fetched the examples with, if it supports telling.
+	IndexKeys []string `json:"indexKeys,omitempty"`
+	// Stages are the number of examples left after each stage: fetching them from storage, checking the
+	// source and flags, then evaluating the expression.
+	Stages []ExplainedStage `json:"stages"`
+	// Nodes are the nodes of the expression tree in pre-order, with how many of the examples that
+	// passed the metadata stage they matched by themselves.
+	Nodes []ExplainedNode `json:"nodes,omitempty"`
+	// ExampleFetched is whether the storage fetched the explained example at all.
+	ExampleFetched bool                      `json:"exampleFetched,omitempty"`
+	Example        *sarfya.FilterExplanation `json:"example,omitempty"`
+}
+
+type ExplainedTerm struct {
+	Term       sarfya.FilterTerm        `json:"term"`
+	Candidates []sarfya.DictionaryEntry `json:"candidates,omitempty"`
+}
+
+type ExplainedStage struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ExplainedNode struct {
+	Expression string `json:"expression"`
+	Depth      int    `json:"depth"`
+	Count      int    `json:"count"`
+}
@@ -0,0 +1,364 @@
+package sarfyaservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gissleh/sarfya"
+	"github.com/gissleh/sarfya/adapters/filedictionary"
+	"github.com/gissleh/sarfya/adapters/jsonstorage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testInputs are in a different order by each QuerySort when matched by `lu`.
+var testInputs = []sarfya.Input{
+	{
+		ID:           "test-0001",
+		Text:         "1Oe 2lu.",
+		Translations: map[string]string{"en": "1+2I-am."},
+		Source:       sarfya.Source{ID: "b", Title: "Beta", Date: "2024-02-01", URL: "https://example.com/b"},
+	},
+	{
+		ID:           "test-0002",
+		Text:         "1Oe 2lu 3uvan.",
+		Translations: map[string]string{"en": "1I 2am 3(a game)."},
+		Source:       sarfya.Source{ID: "a", Title: "Alpha", Date: "2023-05-01", URL: "https://example.com/a"},
+	},
+	{
+		ID:           "test-0003",
+		Text:         "1Uvan 2lu.",
+		Translations: map[string]string{"en": "1(It is a) 2game."},
+		Source:       sarfya.Source{ID: "c", Title: "Alpha", Date: "2022-01-01", URL: "https://example.com/c"},
+	},
+	{
+		ID:     "test-0004",
+		Text:   "1Lu 2lu.",
+		Source: sarfya.Source{ID: "d", Title: "Delta", Date: "2021-01-01", URL: "https://example.com/d"},
+	},
+}
+
+func newTestService(t *testing.T) *Service {
+	dictionary, err := filedictionary.New([]sarfya.DictionaryEntry{
+		{ID: "1380", Word: "oe", PoS: "pn.", Definitions: map[string]string{"en": "I, me"}},
+		{ID: "1044", Word: "lu", PoS: "vin.", Definitions: map[string]string{"en": "be, am, is, are"}},
+		{ID: "2644", Word: "uvan", PoS: "n.", Definitions: map[string]string{"en": "game"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := &Service{
+		Dictionary: dictionary,
+		Storage:    jsonstorage.New(t.TempDir() + "/data.json"),
+	}
+	for _, input := range testInputs {
+		if _, err := service.SaveExample(context.Background(), input, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return service
+}
+
+func TestService_Aggregate(t *testing.T) {
+	service := newTestService(t)
+
+	table := []struct {
+		Filter string
+		Total  int
+	}{
+		{"oe", 2},
+		{"oe && opt:noadjacent", 1},
+		{"lu && opt:noadjacent", 3},
+		{"uvan || oe", 3},
+	}
+
+	for _, row := range table {
+		t.Run(row.Filter, func(t *testing.T) {
+			groups, err := service.QueryExample(context.Background(), row.Filter)
+			if !assert.NoError(t, err) {
+				return
+			}
+			queried := 0
+			for _, group := range groups {
+				queried += len(group.Examples)
+			}
+
+			res, err := service.Aggregate(context.Background(), AggregateRequest{Filter: row.Filter, GroupBy: AGSource})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, row.Total, queried)
+			assert.Equal(t, row.Total, res.Total)
+		})
+	}
+}
+
+func TestService_Query(t *testing.T) {
+	service := newTestService(t)
+
+	table := []struct {
+		Filter string
+		Sort   QuerySort
+		Limit  int
+		Pages  [][]string
+	}{
+		{"lu", QSNewest, 0, [][]string{{"test-0001", "test-0002", "test-0003", "test-0004"}}},
+		{"lu", QSOldest, 0, [][]string{{"test-0004", "test-0003", "test-0002", "test-0001"}}},
+		{"lu", QSSource, 0, [][]string{{"test-0002", "test-0003", "test-0001", "test-0004"}}},
+		{"lu", QSText, 0, [][]string{{"test-0004", "test-0002", "test-0001", "test-0003"}}},
+		{"lu", QSSpans, 0, [][]string{{"test-0004", "test-0001", "test-0002", "test-0003"}}},
+		{"lu", QSOldest, 3, [][]string{{"test-0004", "test-0003", "test-0002"}, {"test-0001"}}},
+		{"lu", QSText, 2, [][]string{{"test-0004", "test-0002"}, {"test-0001", "test-0003"}}},
+		{"lu", QSNewest, 1, [][]string{{"test-0001"}, {"test-0002"}, {"test-0003"}, {"test-0004"}}},
+		{"lu", QSNewest, MaxQueryLimit + 1, [][]string{{"test-0001", "test-0002", "test-0003", "test-0004"}}},
+		{"uvan +> lu", QSNewest, 1, [][]string{{"test-0003"}}},
+		{"uvan +> oe", QSNewest, 0, [][]string{{}}},
+	}
+
+	for _, row := range table {
+		t.Run(fmt.Sprintf("%s,%s,%d", row.Filter, row.Sort, row.Limit), func(t *testing.T) {
+			cursor := ""
+			for i, page := range row.Pages {
+				res, err := service.Query(context.Background(), QueryRequest{Filter: row.Filter, Sort: row.Sort, Limit: row.Limit, Cursor: cursor})
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				ids := make([]string, 0, len(page))
+				for _, group := range res.Groups {
+					for _, match := range group.Examples {
+						ids = append(ids, match.ID)
+					}
+				}
+				assert.Equal(t, page, ids)
+
+				total := 0
+				for _, page := range row.Pages {
+					total += len(page)
+				}
+				assert.Equal(t, total, res.Total)
+
+				if i == len(row.Pages)-1 {
+					assert.Empty(t, res.NextCursor)
+				} else if !assert.NotEmpty(t, res.NextCursor) {
+					return
+				}
+				cursor = res.NextCursor
+			}
+		})
+	}
+}
+
+func TestService_Query_Errors(t *testing.T) {
+	service := newTestService(t)
+
+	res, err := service.Query(context.Background(), QueryRequest{Filter: "lu", Sort: QSOldest, Limit: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	cursor := res.NextCursor
+
+	table := []struct {
+		Name    string
+		Request QueryRequest
+		Error   error
+	}{
+		{"same filter", QueryRequest{Filter: " lu ", Sort: QSOldest, Limit: 2, Cursor: cursor}, nil},
+		{"other filter", QueryRequest{Filter: "lu || oe", Sort: QSOldest, Limit: 1, Cursor: cursor}, ErrInvalidCursor},
+		{"other sort", QueryRequest{Filter: "lu", Sort: QSNewest, Limit: 1, Cursor: cursor}, ErrInvalidCursor},
+		{"garbage", QueryRequest{Filter: "lu", Sort: QSOldest, Cursor: "not a cursor"}, ErrInvalidCursor},
+		{"negative offset", QueryRequest{Filter: "lu", Sort: QSOldest, Cursor: queryCursor(-1, "lu", QSOldest)}, ErrInvalidCursor},
+		{"sort", QueryRequest{Filter: "lu", Sort: "random"}, ErrInvalidSort},
+	}
+
+	for _, row := range table {
+		t.Run(row.Name, func(t *testing.T) {
+			_, err := service.Query(context.Background(), row.Request)
+			if row.Error == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, row.Error)
+			}
+		})
+	}
+}
+
+func TestService_Query_DefaultLimit(t *testing.T) {
+	service := newTestService(t)
+	for i := 0; i < DefaultQueryLimit; i++ {
+		_, err := service.SaveExample(context.Background(), sarfya.Input{
+			Text:   "1Lu.",
+			Source: sarfya.Source{ID: "e", Date: "2020-01-01", URL: "https://example.com/e"},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := service.Query(context.Background(), QueryRequest{Filter: "lu"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, DefaultQueryLimit+len(testInputs), res.Total)
+	assert.Len(t, res.Groups[0].Examples, DefaultQueryLimit)
+	assert.NotEmpty(t, res.NextCursor)
+
+	res, err = service.Query(context.Background(), QueryRequest{Filter: "lu", Cursor: res.NextCursor})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, res.Groups[0].Examples, len(testInputs))
+	assert.Empty(t, res.NextCursor)
+}
+
+func TestService_forEachIndex(t *testing.T) {
+	table := []struct {
+		Name        string
+		Concurrency int
+		Length      int
+		CancelAt    int
+		FailAt      int
+		Completed   int
+		Calls       int
+	}{
+		{"all", 1, 10, -1, -1, 10, 10},
+		{"all concurrent", 4, 10, -1, -1, 10, 10},
+		{"more goroutines than indices", 16, 3, -1, -1, 3, 3},
+		{"default", 0, 10, -1, -1, 10, 10},
+		{"empty", 4, 0, -1, -1, 0, 0},
+		{"failed", 4, 10, -1, 5, 9, 10},
+		{"cancelled", 1, 10, 2, -1, 3, 3},
+		{"cancelled and failed", 1, 10, 6, 4, 6, 7},
+	}
+
+	for _, row := range table {
+		t.Run(row.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			service := &Service{Concurrency: row.Concurrency}
+			calls := make([]int, row.Length)
+			completed := service.forEachIndex(ctx, row.Length, func(i int) error {
+				calls[i] += 1
+				if i == row.CancelAt {
+					cancel()
+				}
+				if i == row.FailAt {
+					return errors.New("failed")
+				}
+
+				return nil
+			})
+
+			callCount := 0
+			for _, count := range calls {
+				assert.LessOrEqual(t, count, 1)
+				callCount += count
+			}
+			assert.Equal(t, row.Completed, completed)
+			assert.Equal(t, row.Calls, callCount)
+		})
+	}
+}
+
+func TestService_Concurrency(t *testing.T) {
+	service := newTestService(t)
+	for i := 0; i < 50; i++ {
+		_, err := service.SaveExample(context.Background(), sarfya.Input{
+			Text:   []string{"1Oe 2lu.", "1Uvan 2lu 3oe.", "1Lu."}[i%3],
+			Source: sarfya.Source{ID: fmt.Sprintf("s%d", i%7), Date: fmt.Sprintf("2020-01-%02d", i%28+1), URL: "https://example.com"},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type results struct {
+		Groups      []FilterMatchGroup
+		Page        *QueryResult
+		Aggregate   *AggregateResult
+		Explanation *QueryExplanation
+	}
+	run := func(concurrency int) results {
+		service.Concurrency = concurrency
+
+		var res results
+		var err error
+		res.Groups, err = service.QueryExample(context.Background(), "lu")
+		assert.NoError(t, err)
+		res.Page, err = service.Query(context.Background(), QueryRequest{Filter: "lu", Sort: QSText, Limit: 10})
+		assert.NoError(t, err)
+		res.Aggregate, err = service.Aggregate(context.Background(), AggregateRequest{Filter: "lu", GroupBy: AGSource})
+		assert.NoError(t, err)
+		res.Explanation, err = service.ExplainQuery(context.Background(), "lu && oe", "test-0002")
+		assert.NoError(t, err)
+
+		return res
+	}
+
+	expected := run(1)
+	assert.Equal(t, 54, expected.Aggregate.Total)
+	for _, concurrency := range []int{1, 2, 8, 64} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				assert.Equal(t, expected, run(concurrency))
+			}
+		})
+	}
+}
+
+func TestService_PartialResult(t *testing.T) {
+	service := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	checkErr := func(t *testing.T, err error) {
+		var partialErr *PartialResultError
+		if assert.ErrorAs(t, err, &partialErr) {
+			assert.Equal(t, 0, partialErr.Checked)
+			assert.Equal(t, len(testInputs), partialErr.Total)
+		}
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+
+	t.Run("QueryExample", func(t *testing.T) {
+		groups, err := service.QueryExample(ctx, "lu")
+		checkErr(t, err)
+		assert.Empty(t, groups)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		res, err := service.Query(ctx, QueryRequest{Filter: "lu", Limit: 1})
+		checkErr(t, err)
+		if assert.NotNil(t, res) {
+			assert.Equal(t, 0, res.Total)
+			assert.Empty(t, res.NextCursor)
+		}
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		res, err := service.Aggregate(ctx, AggregateRequest{Filter: "lu", GroupBy: AGSource})
+		checkErr(t, err)
+		if assert.NotNil(t, res) {
+			assert.Equal(t, 0, res.Total)
+		}
+	})
+
+	t.Run("ExplainQuery", func(t *testing.T) {
+		res, err := service.ExplainQuery(ctx, "lu", "test-0001")
+		checkErr(t, err)
+		if assert.NotNil(t, res) {
+			assert.Equal(t, []ExplainedStage{{Name: "storage", Count: 4}, {Name: "metadata", Count: 0}, {Name: "expression", Count: 0}}, res.Stages)
+			assert.Nil(t, res.Example)
+		}
+	})
+
+	// A partial result is not cached.
+	service.Cache = NewResultCache(16, 0)
+	_, err := service.QueryExample(ctx, "lu")
+	checkErr(t, err)
+	assert.Equal(t, 0, service.Cache.Stats().Entries)
+}
@@ -7,7 +7,26 @@ import (
 
 type ExampleStorage interface {
 	FindExample(ctx context.Context, id string) (*sarfya.Example, error)
-	FetchExamples(ctx context.Context, filter *sarfya.Filter, resolved map[int]sarfya.DictionaryEntry) ([]sarfya.Example, error)
+	FetchExamples(ctx context.Context, filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) ([]sarfya.Example, error)
 	SaveExample(ctx context.Context, example sarfya.Example) error
 	DeleteExample(ctx context.Context, example sarfya.Example) error
 }
+
+type SavedQueryStorage interface {
+	FindSavedQuery(ctx context.Context, id string) (*sarfya.SavedQuery, error)
+	ListSavedQueries(ctx context.Context) ([]sarfya.SavedQuery, error)
+	SaveSavedQuery(ctx context.Context, query sarfya.SavedQuery) error
+	DeleteSavedQuery(ctx context.Context, query sarfya.SavedQuery) error
+}
+
+// FetchExplainer can be implemented by an ExampleStorage to tell which index keys FetchExamples would use for
+// the filter. It should return nil if it would go through all examples.
+type FetchExplainer interface {
+	ExplainFetch(ctx context.Context, filter *sarfya.Filter, candidates map[int][]sarfya.DictionaryEntry) ([]string, error)
+}
+
+// SourceLister can be implemented by an ExampleStorage to list the sources of its examples, which is used
+// to suggest source IDs.
+type SourceLister interface {
+	ListSources(ctx context.Context) ([]sarfya.Source, error)
+}
@@ -0,0 +1,139 @@
+package sarfyaservice
+
+import (
+	"context"
+	"errors"
+	"github.com/gissleh/sarfya"
+	"sort"
+	"strings"
+)
+
+// MaxSuggestions is the most suggestions Suggest will give.
+const MaxSuggestions = 20
+
+// Suggest completes what is being written at the cursor of a partial filter. The cursor is counted in runes.
+// On top of what sarfya.CompleteFilterString suggests, this will suggest dictionary words and, if the storage
+// implements SourceLister, the source IDs.
+func (s *Service) Suggest(ctx context.Context, filterString string, cursor int) (*sarfya.FilterCompletion, error) {
+	completion := sarfya.CompleteFilterString(filterString, cursor)
+
+	switch completion.Kind {
+	case sarfya.FCKWord:
+		words, err := s.suggestWords(ctx, completion.Prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		completion.Suggestions = append(words, completion.Suggestions...)
+	case sarfya.FCKSource:
+		sources, err := s.suggestSources(ctx, completion.Prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		completion.Suggestions = sources
+	}
+
+	if len(completion.Suggestions) > MaxSuggestions {
+		completion.Suggestions = completion.Suggestions[:MaxSuggestions]
+	}
+	if completion.Suggestions == nil {
+		completion.Suggestions = []sarfya.FilterSuggestion{}
+	}
+
+	return &completion, nil
+}
+
+// suggestWords looks up the prefix as it is, then finds the other words starting with it if the dictionary
+// can be listed. The exact matches come first, then the shortest words.
+func (s *Service) suggestWords(ctx context.Context, prefix string) ([]sarfya.FilterSuggestion, error) {
+	if prefix == "" || strings.ContainsAny(prefix, "*?") {
+		return nil, nil
+	}
+
+	res := make([]sarfya.FilterSuggestion, 0, MaxSuggestions)
+	seen := make(map[string]bool, MaxSuggestions)
+	add := func(entry sarfya.DictionaryEntry) {
+		key := entry.ID
+		if key == "" {
+			key = entry.Word + "\x00" + entry.PoS
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		label := entry.PoS
+		if definition := entry.Definitions["en"]; definition != "" {
+			label += " " + definition
+		}
+
+		res = append(res, sarfya.FilterSuggestion{
+			Kind:    sarfya.FCKWord,
+			Text:    entry.Word,
+			Label:   strings.TrimSpace(label),
+			EntryID: entry.ID,
+		})
+	}
+
+	exact, err := s.Dictionary.Lookup(ctx, prefix, false)
+	if err != nil && !errors.Is(err, sarfya.ErrDictionaryEntryNotFound) {
+		return nil, err
+	}
+	for _, entry := range exact {
+		add(entry)
+	}
+
+	entries, err := sarfya.ListDictionaryEntries(ctx, s.Dictionary)
+	if errors.Is(err, sarfya.ErrDictionaryNotListable) {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	lowerPrefix := strings.ToLower(prefix)
+	matches := make([]sarfya.DictionaryEntry, 0, MaxSuggestions)
+	for _, entry := range entries {
+		if strings.HasPrefix(strings.ToLower(entry.Word), lowerPrefix) {
+			matches = append(matches, entry)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if len(matches[i].Word) != len(matches[j].Word) {
+			return len(matches[i].Word) < len(matches[j].Word)
+		}
+
+		return matches[i].Word < matches[j].Word
+	})
+
+	for _, entry := range matches {
+		if len(res) == MaxSuggestions {
+			break
+		}
+
+		add(entry)
+	}
+
+	return res, nil
+}
+
+func (s *Service) suggestSources(ctx context.Context, prefix string) ([]sarfya.FilterSuggestion, error) {
+	lister, ok := s.Storage.(SourceLister)
+	if !ok {
+		return nil, nil
+	}
+
+	sources, err := lister.ListSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]sarfya.FilterSuggestion, 0, MaxSuggestions)
+	for _, source := range sources {
+		if source.ID != "" && strings.HasPrefix(source.ID, prefix) {
+			res = append(res, sarfya.FilterSuggestion{Kind: sarfya.FCKSource, Text: source.ID, Label: source.Title})
+		}
+	}
+
+	return res, nil
+}
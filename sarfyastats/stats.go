@@ -0,0 +1,298 @@
+// Package sarfyastats computes word frequencies, affix usage and collocations over the examples.
+package sarfyastats
+
+import (
+	"context"
+	"github.com/gissleh/sarfya"
+	"math"
+	"sort"
+)
+
+// ExampleLister is implemented by the storages that can list all their examples, like jsonstorage.
+type ExampleLister interface {
+	ListExamples(ctx context.Context) ([]sarfya.Example, error)
+}
+
+// Collect lists all examples and computes the statistics for them.
+func Collect(ctx context.Context, lister ExampleLister) (*Statistics, error) {
+	examples, err := lister.ListExamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromExamples(examples), nil
+}
+
+// FromExamples computes the statistics for the examples. The examples are sorted by ID first, so the
+// result does not depend on their order. A word with more than one dictionary entry is only counted as
+// the first one.
+func FromExamples(examples []sarfya.Example) *Statistics {
+	examples = append(examples[:0:0], examples...)
+	sort.Slice(examples, func(i, j int) bool {
+		return examples[i].ID < examples[j].ID
+	})
+
+	s := &Statistics{
+		entries: make(map[string]*EntryStatistics, 256),
+		pairs:   make(map[[2]string]int, 1024),
+	}
+
+	for _, example := range examples {
+		s.addExample(&example)
+	}
+
+	return s
+}
+
+// Statistics are computed by Collect or FromExamples, and are safe to query from multiple goroutines.
+type Statistics struct {
+	// Examples is the number of examples the statistics were computed from.
+	Examples int `json:"examples"`
+	// Words is the number of dictionary entries used across all examples.
+	Words int `json:"words"`
+	// Pairs is the number of adjacent entry pairs across all examples.
+	Pairs int `json:"pairs"`
+
+	entries map[string]*EntryStatistics
+	pairs   map[[2]string]int
+}
+
+// Entry gives the statistics of the entry, or nil if it is not used in any example.
+func (s *Statistics) Entry(id string) *EntryStatistics {
+	return s.entries[id]
+}
+
+// TopEntries lists the most used entries, up to the limit. A limit of 0 lists all of them.
+func (s *Statistics) TopEntries(limit int) []EntryStatistics {
+	res := make([]EntryStatistics, 0, len(s.entries))
+	for _, entry := range s.entries {
+		res = append(res, *entry)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Frequency == res[j].Frequency {
+			return res[i].ID < res[j].ID
+		}
+
+		return res[i].Frequency > res[j].Frequency
+	})
+
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+
+	return res
+}
+
+// Collocations lists the entries that occur next to the entry at least minCount times, with the
+// strongest associations by PMI first.
+func (s *Statistics) Collocations(id string, minCount int) []Collocation {
+	entry := s.entries[id]
+	if entry == nil {
+		return []Collocation{}
+	}
+
+	res := make([]Collocation, 0, 16)
+	indices := make(map[string]int, 16)
+	for pair, count := range s.pairs {
+		var other string
+		var before bool
+		if pair[0] == id {
+			other = pair[1]
+		} else if pair[1] == id {
+			other = pair[0]
+			before = true
+		} else {
+			continue
+		}
+
+		index, ok := indices[other]
+		if !ok {
+			index = len(res)
+			indices[other] = index
+			res = append(res, Collocation{EntryID: other, Word: s.entries[other].Word})
+		}
+
+		// A word next to itself, like in `ayoe oe`, is counted both ways.
+		res[index].Count += count
+		if before || pair[0] == pair[1] {
+			res[index].Before += count
+		}
+		if !before {
+			res[index].After += count
+		}
+	}
+
+	ri := 0
+	for _, collocation := range res {
+		if collocation.Count < minCount {
+			continue
+		}
+
+		// The pair probability counts both orders, so the number of possible pairs is doubled.
+		pPair := float64(collocation.Count) / float64(s.Pairs*2)
+		pEntry := float64(entry.Frequency) / float64(s.Words)
+		pOther := float64(s.entries[collocation.EntryID].Frequency) / float64(s.Words)
+		collocation.PMI = math.Log2(pPair / (pEntry * pOther))
+
+		res[ri] = collocation
+		ri += 1
+	}
+	res = res[:ri]
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].PMI == res[j].PMI {
+			if res[i].Count == res[j].Count {
+				return res[i].EntryID < res[j].EntryID
+			}
+
+			return res[i].Count > res[j].Count
+		}
+
+		return res[i].PMI > res[j].PMI
+	})
+
+	return res
+}
+
+func (s *Statistics) addExample(example *sarfya.Example) {
+	s.Examples += 1
+
+	ids := make([]int, 0, len(example.Words))
+	for id := range example.Words {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		word := exampleWord(example, id)
+		if word == nil {
+			continue
+		}
+
+		entry := s.entries[word.ID]
+		if entry == nil {
+			entry = &EntryStatistics{ID: word.ID, Word: word.Word, PoS: word.PoS}
+			s.entries[word.ID] = entry
+		}
+
+		entry.add(word)
+		s.Words += 1
+		if !seen[word.ID] {
+			seen[word.ID] = true
+			entry.Examples += 1
+		}
+	}
+
+	for i, part := range example.Text {
+		if len(part.IDs) == 0 || part.Alt {
+			continue
+		}
+
+		next := example.Text.NextLinked(i, false)
+		if next == -1 {
+			continue
+		}
+
+		for _, id := range part.IDs {
+			for _, nextID := range example.Text[next].IDs {
+				// Split words like `uvan si` are linked to several parts, and should not pair with themselves.
+				if id == nextID {
+					continue
+				}
+
+				word := exampleWord(example, id)
+				nextWord := exampleWord(example, nextID)
+				if word != nil && nextWord != nil {
+					s.pairs[[2]string{word.ID, nextWord.ID}] += 1
+					s.Pairs += 1
+				}
+			}
+		}
+	}
+}
+
+// exampleWord gives the entry the example's word is counted as, or nil if it has none. When the lookup filter
+// has left more than one entry, the others are alternatives that could not be ruled out, so only the first
+// one is counted.
+func exampleWord(example *sarfya.Example, id int) *sarfya.DictionaryEntry {
+	words := example.Words[id]
+	if len(words) == 0 || words[0].ID == "" {
+		return nil
+	}
+
+	return &words[0]
+}
+
+type EntryStatistics struct {
+	ID   string `json:"id"`
+	Word string `json:"word"`
+	PoS  string `json:"pos"`
+	// Frequency is the number of times the entry is used.
+	Frequency int `json:"frequency"`
+	// Examples is the number of examples the entry is used in.
+	Examples int `json:"examples"`
+	// Prefixes, Infixes, Suffixes and Lenitions count how often each affix is used with the entry. Spelling
+	// variants that DictionaryEntry.HasSuffix and HasInfix treat as the same are counted together.
+	Prefixes  map[string]int `json:"prefixes,omitempty"`
+	Infixes   map[string]int `json:"infixes,omitempty"`
+	Suffixes  map[string]int `json:"suffixes,omitempty"`
+	Lenitions map[string]int `json:"lenitions,omitempty"`
+	// NoAffixes is the number of times the entry is used without any affixes or lenition.
+	NoAffixes int `json:"noAffixes"`
+}
+
+func (e *EntryStatistics) add(word *sarfya.DictionaryEntry) {
+	e.Frequency += 1
+
+	if len(word.Prefixes) == 0 && len(word.Infixes) == 0 && len(word.Suffixes) == 0 && len(word.Lenitions) == 0 {
+		e.NoAffixes += 1
+		return
+	}
+
+	for _, prefix := range word.Prefixes {
+		e.Prefixes = countAffix(e.Prefixes, prefix, (*sarfya.DictionaryEntry).HasPrefix, sarfya.DictionaryEntry{Prefixes: []string{prefix}})
+	}
+	for _, infix := range word.Infixes {
+		e.Infixes = countAffix(e.Infixes, infix, (*sarfya.DictionaryEntry).HasInfix, sarfya.DictionaryEntry{Infixes: []string{infix}})
+	}
+	for _, suffix := range word.Suffixes {
+		e.Suffixes = countAffix(e.Suffixes, suffix, (*sarfya.DictionaryEntry).HasSuffix, sarfya.DictionaryEntry{Suffixes: []string{suffix}})
+	}
+	for _, lenition := range word.Lenitions {
+		e.Lenitions = countAffix(e.Lenitions, lenition, (*sarfya.DictionaryEntry).HasLenition, sarfya.DictionaryEntry{Lenitions: []string{lenition}})
+	}
+}
+
+// countAffix counts the affix under the first spelling of it that was seen.
+func countAffix(counts map[string]int, affix string, has func(e *sarfya.DictionaryEntry, affix string) bool, single sarfya.DictionaryEntry) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int, 4)
+	}
+
+	if _, ok := counts[affix]; !ok {
+		for key := range counts {
+			if has(&single, key) {
+				affix = key
+				break
+			}
+		}
+	}
+
+	counts[affix] += 1
+	return counts
+}
+
+type Collocation struct {
+	EntryID string `json:"entryId"`
+	Word    string `json:"word"`
+	// Count is the number of times the entries are next to each other in either order.
+	Count int `json:"count"`
+	// Before is the number of times this entry comes right before the queried one.
+	Before int `json:"before"`
+	// After is the number of times this entry comes right after the queried one.
+	After int `json:"after"`
+	// PMI is the pointwise mutual information of the entries being next to each other.
+	PMI float64 `json:"pmi"`
+}
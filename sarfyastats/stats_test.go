@@ -0,0 +1,128 @@
+package sarfyastats
+
+import (
+	"github.com/gissleh/sarfya"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+var (
+	entryOe     = sarfya.DictionaryEntry{ID: "1380", Word: "oe", PoS: "pn."}
+	entryLu     = sarfya.DictionaryEntry{ID: "1044", Word: "lu", PoS: "vin."}
+	entryUvan   = sarfya.DictionaryEntry{ID: "2644", Word: "uvan", PoS: "n."}
+	entryUvanSi = sarfya.DictionaryEntry{ID: "2648", Word: "uvan si", PoS: "vin."}
+	entryLuAdj  = sarfya.DictionaryEntry{ID: "3148", Word: "lu+", PoS: "adj."}
+)
+
+func withSuffix(entry sarfya.DictionaryEntry, suffix string) sarfya.DictionaryEntry {
+	entry.Suffixes = []string{suffix}
+	return entry
+}
+
+// testExamples has 9 words and 5 pairs: oe+lu and lu+uvan, oe+oe, uvan si+lu, where the two parts of
+// uvan si do not pair with each other, and lu+uvan where only the first of lu's alternatives is counted.
+var testExamples = []sarfya.Example{
+	{
+		ID:    "c",
+		Text:  sarfya.ParseSentence("1Uvan 1soli 2lu."),
+		Words: map[int][]sarfya.DictionaryEntry{1: {entryUvanSi}, 2: {entryLu}},
+	},
+	{
+		ID:    "a",
+		Text:  sarfya.ParseSentence("1Oe 2lu 3uvan."),
+		Words: map[int][]sarfya.DictionaryEntry{1: {entryOe}, 2: {entryLu}, 3: {entryUvan}},
+	},
+	{
+		ID:    "b",
+		Text:  sarfya.ParseSentence("1Oeru 2oer."),
+		Words: map[int][]sarfya.DictionaryEntry{1: {withSuffix(entryOe, "ru")}, 2: {withSuffix(entryOe, "r")}},
+	},
+	{
+		ID:    "d",
+		Text:  sarfya.ParseSentence("1Lu 2uvan."),
+		Words: map[int][]sarfya.DictionaryEntry{1: {entryLu, entryLuAdj}, 2: {entryUvan}},
+	},
+}
+
+func TestFromExamples(t *testing.T) {
+	stats := FromExamples(testExamples)
+
+	assert.Equal(t, 4, stats.Examples)
+	assert.Equal(t, 9, stats.Words)
+	assert.Equal(t, 5, stats.Pairs)
+
+	oe := stats.Entry(entryOe.ID)
+	if assert.NotNil(t, oe) {
+		assert.Equal(t, 3, oe.Frequency)
+		assert.Equal(t, 2, oe.Examples)
+		assert.Equal(t, 1, oe.NoAffixes)
+		assert.Equal(t, map[string]int{"ru": 2}, oe.Suffixes)
+	}
+	assert.Nil(t, stats.Entry("0000"))
+	assert.Nil(t, stats.Entry(entryLuAdj.ID))
+	if lu := stats.Entry(entryLu.ID); assert.NotNil(t, lu) {
+		assert.Equal(t, 3, lu.Frequency)
+		assert.Equal(t, 3, lu.Examples)
+	}
+
+	top := stats.TopEntries(2)
+	assert.Equal(t, []string{entryLu.ID, entryOe.ID}, []string{top[0].ID, top[1].ID})
+}
+
+func TestStatistics_Collocations(t *testing.T) {
+	stats := FromExamples(testExamples)
+
+	// log2(P(pair) / (P(a) * P(b))), where P(pair) is the count over 2*5 pairs and P(word) is the frequency over 9 words.
+	pmi := func(count, frequencyA, frequencyB int) float64 {
+		return math.Log2((float64(count) / 10) / ((float64(frequencyA) / 9) * (float64(frequencyB) / 9)))
+	}
+
+	table := []struct {
+		ID           string
+		MinCount     int
+		Collocations []Collocation
+	}{
+		{entryOe.ID, 1, []Collocation{
+			{EntryID: entryLu.ID, Word: "lu", Count: 1, Before: 0, After: 1, PMI: pmi(1, 3, 3)},
+			{EntryID: entryOe.ID, Word: "oe", Count: 1, Before: 1, After: 1, PMI: pmi(1, 3, 3)},
+		}},
+		{entryLu.ID, 1, []Collocation{
+			{EntryID: entryUvan.ID, Word: "uvan", Count: 2, Before: 0, After: 2, PMI: pmi(2, 3, 2)},
+			{EntryID: entryUvanSi.ID, Word: "uvan si", Count: 1, Before: 1, After: 0, PMI: pmi(1, 3, 1)},
+			{EntryID: entryOe.ID, Word: "oe", Count: 1, Before: 1, After: 0, PMI: pmi(1, 3, 3)},
+		}},
+		{entryUvanSi.ID, 1, []Collocation{
+			{EntryID: entryLu.ID, Word: "lu", Count: 1, Before: 0, After: 1, PMI: pmi(1, 1, 3)},
+		}},
+		{entryLu.ID, 2, []Collocation{
+			{EntryID: entryUvan.ID, Word: "uvan", Count: 2, Before: 0, After: 2, PMI: pmi(2, 3, 2)},
+		}},
+		{entryLuAdj.ID, 1, []Collocation{}},
+		{"0000", 1, []Collocation{}},
+	}
+
+	for _, row := range table {
+		t.Run(row.ID, func(t *testing.T) {
+			collocations := stats.Collocations(row.ID, row.MinCount)
+			if !assert.Len(t, collocations, len(row.Collocations)) {
+				return
+			}
+
+			for i, collocation := range collocations {
+				assert.InDelta(t, row.Collocations[i].PMI, collocation.PMI, 1e-9)
+				collocation.PMI = row.Collocations[i].PMI
+				assert.Equal(t, row.Collocations[i], collocation)
+			}
+		})
+	}
+}
+
+func TestCountAffix(t *testing.T) {
+	var counts map[string]int
+	for _, suffix := range []string{"ti", "it", "ti", "ìl", "l", "ru"} {
+		counts = countAffix(counts, suffix, (*sarfya.DictionaryEntry).HasSuffix, sarfya.DictionaryEntry{Suffixes: []string{suffix}})
+	}
+
+	assert.Equal(t, map[string]int{"ti": 3, "ìl": 2, "ru": 1}, counts)
+}
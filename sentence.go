@@ -3,8 +3,11 @@ package sarfya
 import (
 	"fmt"
 	"io"
+	"regexp"
+	"slices"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const syntaxSet = ".,;:–—!? ()[]{}/0123456789\n"
@@ -276,31 +279,197 @@ func (s Sentence) HasPartID(id int) bool {
 	return false
 }
 
+// SearchRaw finds the spans of parts where the query occurs in the raw text. Both are lowercased, and
+// everything but letters and spaces is left out.
 func (s Sentence) SearchRaw(query string) [][]int {
-	var indicesStack [64]int
-	indices := indicesStack[:0]
+	return s.searchRaw(query, normalizeRawRune)
+}
 
-	querySb := strings.Builder{}
-	for _, ch := range query {
-		if unicode.IsLetter(ch) || ch == ' ' {
-			querySb.WriteRune(unicode.ToLower(ch))
+// SearchRawFolded is like SearchRaw, but it also folds diacritics so that `kameie` finds `kaméie` and
+// `ä`/`ì` can be typed as `a`/`i`. The tìftang is kept as a letter in all its forms so that it does not
+// merge words like `tìftang` and `tì'ftang`.
+func (s Sentence) SearchRawFolded(query string) [][]int {
+	return s.searchRaw(query, foldRawRune)
+}
+
+// SearchRawRegexp finds the spans of parts where the regular expression matches the raw text, normalized
+// like SearchRaw or SearchRawFolded. Empty matches are left out.
+//
+// The assertions put in by translateRawRegexp are checked on each match the expression finds, and a match
+// that fails them is tried again from the next position.
+func (s Sentence) SearchRawRegexp(re *regexp.Regexp, fold bool) [][]int {
+	normalize := normalizeRawRune
+	if fold {
+		normalize = foldRawRune
+	}
+
+	// The spaces around the text are only there for SearchRaw, and would keep ^ and $ from matching.
+	text, indices := s.normalizedRaw(normalize)
+	inner := text[1 : len(text)-1]
+
+	names := re.SubexpNames()
+	hasAssertions := slices.ContainsFunc(names, func(name string) bool { return strings.HasPrefix(name, rawAssertionPrefix) })
+
+	res := make([][]int, 0)
+	pos := 0
+	for pos <= len(inner) {
+		loc := re.FindStringSubmatchIndex(inner[pos:])
+		if loc == nil {
+			break
+		}
+		for i := range loc {
+			if loc[i] != -1 {
+				loc[i] += pos
+			}
+		}
+
+		if loc[0] == loc[1] || (hasAssertions && !checkRawAssertions(inner, names, loc)) {
+			if loc[0] == len(inner) {
+				break
+			}
+
+			_, size := utf8.DecodeRuneInString(inner[loc[0]:])
+			pos = loc[0] + size
+			continue
 		}
+
+		if match := rawRangeParts(text, indices, loc[0]+1, loc[1]+1); match != nil {
+			res = append(res, match)
+		}
+		pos = loc[1]
 	}
-	query = querySb.String()
 
+	return res
+}
+
+const rawAssertionPrefix = "sarfya_"
+
+// translateRawRegexp makes the regular expression work on the normalized raw text, which only has lowercase
+// letters and spaces. The letters include ä and ì, which RE2's ASCII-only \w and \b do not know about, so
+// \w and \W become \pL and \PL. The \b, \B, ^, $, \A and \z assertions become empty named groups that
+// SearchRawRegexp checks against the text, since they cannot be written for letters in RE2, and since it
+// has to search from the middle of the text.
+func translateRawRegexp(pattern string) string {
 	sb := strings.Builder{}
-	sb.WriteRune(' ')
-	for _, part := range s {
-		indices = append(indices, sb.Len())
-		for _, ch := range part.Text {
-			if unicode.IsLetter(ch) || ch == ' ' {
-				sb.WriteRune(unicode.ToLower(ch))
+	assertion := func(name string) {
+		sb.WriteString("(?P<" + rawAssertionPrefix + name + ">)")
+	}
+
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '\\' && i+1 < len(pattern):
+			i += 1
+			switch next := pattern[i]; {
+			case next == 'w':
+				sb.WriteString(`\pL`)
+			case next == 'W':
+				sb.WriteString(`\PL`)
+			case next == 'Q':
+				end := strings.Index(pattern[i:], `\E`)
+				if end == -1 {
+					end = len(pattern) - i
+				} else {
+					end += 2
+				}
+				sb.WriteString(`\` + pattern[i:i+end])
+				i += end - 1
+			case inClass:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			case next == 'b':
+				assertion("b")
+			case next == 'B':
+				assertion("nb")
+			case next == 'A':
+				assertion("start")
+			case next == 'z':
+				assertion("end")
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+		case inClass:
+			if ch == '[' && strings.HasPrefix(pattern[i:], "[:") {
+				if end := strings.Index(pattern[i:], ":]"); end != -1 {
+					sb.WriteString(pattern[i : i+end+2])
+					i += end + 1
+					continue
+				}
+			}
+			if ch == ']' {
+				inClass = false
 			}
+			sb.WriteByte(ch)
+		case ch == '[':
+			inClass = true
+			sb.WriteByte(ch)
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i += 1
+				sb.WriteByte('^')
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i += 1
+				sb.WriteByte(']')
+			}
+		case ch == '^':
+			assertion("start")
+		case ch == '$':
+			assertion("end")
+		default:
+			sb.WriteByte(ch)
 		}
 	}
-	sb.WriteRune(' ')
 
-	text := sb.String()
+	return sb.String()
+}
+
+// checkRawAssertions checks the assertions of translateRawRegexp that took part in the match.
+func checkRawAssertions(text string, names []string, loc []int) bool {
+	isLetterAt := func(index int) bool {
+		return index >= 0 && index < len(text) && text[index] != ' '
+	}
+
+	for i, name := range names {
+		pos := loc[i*2]
+		if pos == -1 || !strings.HasPrefix(name, rawAssertionPrefix) {
+			continue
+		}
+
+		// The letter before pos can take more than one byte, but it is never a space.
+		before := pos > 0 && isLetterAt(pos-1)
+		after := isLetterAt(pos)
+
+		var ok bool
+		switch name[len(rawAssertionPrefix):] {
+		case "b":
+			ok = before != after
+		case "nb":
+			ok = before == after
+		case "start":
+			ok = pos == 0
+		case "end":
+			ok = pos == len(text)
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s Sentence) searchRaw(query string, normalize func(ch rune) rune) [][]int {
+	querySb := strings.Builder{}
+	for _, ch := range query {
+		if ch := normalize(ch); ch != -1 {
+			querySb.WriteRune(ch)
+		}
+	}
+	query = querySb.String()
+
+	text, indices := s.normalizedRaw(normalize)
 	pos := 0
 	res := make([][]int, 0)
 
@@ -313,37 +482,93 @@ func (s Sentence) SearchRaw(query string) [][]int {
 		index := relIndex + pos
 		pos = index + 1
 
-		startIndex := -1
-		endIndex := -1
-		for i, partIndex := range indices {
-			nextIndex := len(text)
-			if i < len(indices)-1 {
-				nextIndex = indices[i+1]
-			}
+		if match := rawRangeParts(text, indices, index, index+len(query)); match != nil {
+			res = append(res, match)
+		}
+	}
 
-			if partIndex >= index || nextIndex > index {
-				if partIndex >= index+len(query) {
-					break
-				}
+	return res
+}
 
-				if startIndex == -1 {
-					startIndex = i
-				}
-				endIndex = i
+// normalizedRaw gives the normalized raw text surrounded by spaces, and the index each part starts at in it.
+func (s Sentence) normalizedRaw(normalize func(ch rune) rune) (string, []int) {
+	indices := make([]int, 0, len(s))
+
+	sb := strings.Builder{}
+	sb.WriteRune(' ')
+	for _, part := range s {
+		indices = append(indices, sb.Len())
+		for _, ch := range part.Text {
+			if ch := normalize(ch); ch != -1 {
+				sb.WriteRune(ch)
 			}
 		}
+	}
+	sb.WriteRune(' ')
+
+	return sb.String(), indices
+}
 
-		if startIndex != -1 && endIndex != -1 {
-			match := make([]int, 0, endIndex-startIndex+1)
-			for i := startIndex; i <= endIndex; i++ {
-				match = append(match, i)
+// rawRangeParts gives the indices of the parts covering the range of the normalized raw text.
+func rawRangeParts(text string, indices []int, index, end int) []int {
+	startIndex := -1
+	endIndex := -1
+	for i, partIndex := range indices {
+		nextIndex := len(text)
+		if i < len(indices)-1 {
+			nextIndex = indices[i+1]
+		}
+
+		if partIndex >= index || nextIndex > index {
+			if partIndex >= end {
+				break
 			}
 
-			res = append(res, match)
+			if startIndex == -1 {
+				startIndex = i
+			}
+			endIndex = i
 		}
 	}
 
-	return res
+	if startIndex == -1 || endIndex == -1 {
+		return nil
+	}
+
+	match := make([]int, 0, endIndex-startIndex+1)
+	for i := startIndex; i <= endIndex; i++ {
+		match = append(match, i)
+	}
+
+	return match
+}
+
+// normalizeRawRune gives the lowercase letter or space, or -1 if the rune should be left out.
+func normalizeRawRune(ch rune) rune {
+	if unicode.IsLetter(ch) || ch == ' ' {
+		return unicode.ToLower(ch)
+	}
+
+	return -1
+}
+
+// foldRawRune is like normalizeRawRune, but folds diacritics and keeps the tìftang.
+func foldRawRune(ch rune) rune {
+	ch = unicode.ToLower(ch)
+	if folded, ok := rawFoldTable[ch]; ok {
+		return folded
+	}
+
+	return normalizeRawRune(ch)
+}
+
+var rawFoldTable = map[rune]rune{
+	'ä': 'a', 'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'å': 'a', 'ā': 'a',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o', 'ō': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u',
+	'\'': '\'', '’': '\'', '‘': '\'', 'ʼ': '\'', '`': '\'', '´': '\'',
 }
 
 func (s Sentence) isDash(index int) bool {
@@ -365,3 +365,64 @@ func TestSentence_SearchRaw(t *testing.T) {
 		})
 	}
 }
+
+func TestSentence_SearchRawFolded(t *testing.T) {
+	table := []struct {
+		S string
+		Q string
+		R [][]int
+	}{
+		{"1oel 2ngati 3kaméie.", "kameie", [][]int{{4}}},
+		{"1oel 2ngati 3kameie.", "kaméie", [][]int{{4}}},
+		{"1Fìpamrelìri 2oeyä 3lu", "fipamreliri oeya", [][]int{{0, 1, 2}}},
+		{"1Tì'ftang 2tìftang", "tiftang", [][]int{{2}}},
+		{"1Tì’ftang 2tìftang", "ti'ftang", [][]int{{0}}},
+		{"Run {(fìlì'u)}, rutxe!", "FILI'U", [][]int{{1}}},
+	}
+
+	for _, row := range table {
+		t.Run(fmt.Sprintf("`%s`,`%s`", row.S, row.Q), func(t *testing.T) {
+			s := ParseSentence(row.S)
+			assert.Equal(t, row.R, s.SearchRawFolded(row.Q))
+		})
+	}
+}
+
+func TestSentence_SearchRawRegexp(t *testing.T) {
+	table := []struct {
+		S    string
+		Q    string
+		Fold bool
+		R    [][]int
+	}{
+		{"1oel 2ngati 3kameie.", `\bka\w+`, false, [][]int{{4}}},
+		{"1oel 2ngati 3kameie.", `i k`, false, [][]int{{2, 3, 4}}},
+		{"1oel 2ngati 3kameie.", `^oel`, false, [][]int{{0}}},
+		{"1oel 2ngati 3kameie.", `^ngati`, false, [][]int{}},
+		{"1oel 2ngati 3kameie.", `\Akameie$`, false, [][]int{}},
+		{"1oel 2ngati 3kameie.", `[^ ]+$`, false, [][]int{{4}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `oeyä\b`, false, [][]int{{2}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\boeyä\b`, false, [][]int{{2}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\w+ä\b`, false, [][]int{{2}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `^\w+\W`, false, [][]int{{0, 1}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\Bpam`, false, [][]int{{0}}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\bpam`, false, [][]int{}},
+		{"1Lu 2lu 3lul", `\blu\b`, false, [][]int{{0}, {2}}},
+		{"1Lu 2lu 3lul", `\Qlu\b\E|lul`, false, [][]int{{4}}},
+		{"1Uvansi", `uvan\b|uvansi`, false, [][]int{}},
+		{"1oel 2ngati 3kameie.", `x*`, false, [][]int{}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\bfip`, false, [][]int{}},
+		{"1Fìpamrelìri 2oeyä 3lu", `\bfip`, true, [][]int{{0}}},
+		{"1Tì'ftang 2tìftang", `ti'?ftang`, true, [][]int{{0}, {2}}},
+	}
+
+	for _, row := range table {
+		t.Run(fmt.Sprintf("`%s`,`%s`", row.S, row.Q), func(t *testing.T) {
+			s := ParseSentence(row.S)
+			re, err := compileFilterRegexp(row.Q, row.Fold)
+			if assert.NoError(t, err) {
+				assert.Equal(t, row.R, s.SearchRawRegexp(re, row.Fold))
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package sarfya
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxSpellingSuggestions is the most suggestions SuggestSpellings will give.
+const MaxSpellingSuggestions = 5
+
+// SuggestSpellings finds the dictionary words closest to a word that did not match anything, for "did you mean"
+// suggestions. The distance is an edit distance where the common misspellings of Na'vi, like a for ä, i for ì,
+// a left out ', a single vowel for a double one or k for kx, only cost half as much as other edits. Only the
+// entries that pass the check function are considered if it's not nil.
+//
+// Nothing is suggested if the dictionary cannot list its entries, since the suggestions are only a courtesy.
+func SuggestSpellings(ctx context.Context, dictionary Dictionary, word string, check func(entry *DictionaryEntry) bool) []string {
+	entries, err := ListDictionaryEntries(ctx, dictionary)
+	if err != nil {
+		return nil
+	}
+
+	search := []rune(strings.ToLower(word))
+	maxDistance := 2
+	if len(search) > 4 {
+		maxDistance = 4
+	}
+
+	type candidate struct {
+		word     string
+		distance int
+	}
+	candidates := make([]candidate, 0, 16)
+	for _, entry := range entries {
+		entryWord := strings.TrimSuffix(entry.Word, "+")
+		if lengthDiff := utf8.RuneCountInString(entryWord) - len(search); lengthDiff > maxDistance || -lengthDiff > maxDistance {
+			continue
+		}
+		if check != nil && !check(&entry) {
+			continue
+		}
+		if slices.ContainsFunc(candidates, func(c candidate) bool { return c.word == entryWord }) {
+			continue
+		}
+
+		distance := spellingDistance(search, []rune(strings.ToLower(entryWord)))
+		if distance > 0 && distance <= maxDistance {
+			candidates = append(candidates, candidate{word: entryWord, distance: distance})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+
+		return strings.Compare(a.word, b.word)
+	})
+	if len(candidates) > MaxSpellingSuggestions {
+		candidates = candidates[:MaxSpellingSuggestions]
+	}
+
+	res := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		res = append(res, candidate.word)
+	}
+
+	return res
+}
+
+// spellingDistance is a weighted edit distance where a regular edit costs 2, and the edits listed in
+// SuggestSpellings cost 1.
+func spellingDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := 1; j <= len(b); j++ {
+		prev[j] = prev[j-1] + spellingOmissionCost(b, j-1)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = prev[0] + spellingOmissionCost(a, i-1)
+		for j := 1; j <= len(b); j++ {
+			curr[j] = min(
+				prev[j]+spellingOmissionCost(a, i-1),
+				curr[j-1]+spellingOmissionCost(b, j-1),
+				prev[j-1]+spellingSubstitutionCost(a[i-1], b[j-1]),
+			)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// spellingOmissionCost is the cost of leaving out the rune at index i of the word.
+func spellingOmissionCost(word []rune, i int) int {
+	switch {
+	case word[i] == '\'' || word[i] == '’':
+		return 1
+	case word[i] == 'x' && i > 0 && strings.ContainsRune("kpt", word[i-1]):
+		return 1
+	case strings.ContainsRune("aäeiìou", word[i]) && i > 0 && word[i-1] == word[i]:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func spellingSubstitutionCost(a, b rune) int {
+	switch {
+	case a == b:
+		return 0
+	case (a == 'a' && b == 'ä') || (a == 'ä' && b == 'a'):
+		return 1
+	case (a == 'i' && b == 'ì') || (a == 'ì' && b == 'i'):
+		return 1
+	case (a == '\'' && b == '’') || (a == '’' && b == '\''):
+		return 0
+	default:
+		return 2
+	}
+}
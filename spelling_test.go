@@ -0,0 +1,93 @@
+package sarfya
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// spellingTestDict has fpom for the misspelled fpoom to be close to.
+var spellingTestDict = dummyDict.with(wordFpom)
+
+func TestSpellingDistance(t *testing.T) {
+	table := []struct {
+		A        string
+		B        string
+		Expected int
+	}{
+		{"uvan", "uvan", 0},
+		{"la", "lä", 1},
+		{"tirea", "tìrea", 1},
+		{"o", "'o'", 2},
+		{"kaltxi", "kalti", 1},
+		{"kxetse", "ketse", 1},
+		{"pxasul", "pasul", 1},
+		{"fpoom", "fpom", 1},
+		{"uvan", "ovan", 2},
+		{"uvan", "uva", 2},
+		{"ätxäle", "atale", 3},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.A+" "+tt.B, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, spellingDistance([]rune(tt.A), []rune(tt.B)))
+			assert.Equal(t, tt.Expected, spellingDistance([]rune(tt.B), []rune(tt.A)))
+		})
+	}
+}
+
+func TestSuggestSpellings(t *testing.T) {
+	table := []struct {
+		Word     string
+		Expected []string
+	}{
+		{"fpoom", []string{"fpom"}},
+		{"O'", []string{"'o'", "oe"}},
+		{"uvn", []string{"uvan"}},
+		{"tìftang", []string{}},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.Word, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, SuggestSpellings(context.Background(), spellingTestDict, tt.Word, nil))
+		})
+	}
+
+	t.Run("check", func(t *testing.T) {
+		assert.Equal(t, []string{"oe"}, SuggestSpellings(context.Background(), spellingTestDict, "o", func(entry *DictionaryEntry) bool {
+			return entry.PoS == "pn."
+		}))
+	})
+
+	t.Run("not_listable", func(t *testing.T) {
+		assert.Nil(t, SuggestSpellings(context.Background(), CombinedDictionary{}, "fpoom", nil))
+	})
+}
+
+func TestParseFilter_SpellingSuggestions(t *testing.T) {
+	_, _, err := ParseFilter(context.Background(), "uvan +> fpoom", spellingTestDict)
+	var parseErr FilterParseError
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "no_matched_entries", parseErr.Code)
+		assert.Equal(t, []string{"fpom"}, parseErr.Suggestions)
+	}
+
+	_, _, err = ParseFilter(context.Background(), "fpom:adj.", spellingTestDict)
+	if assert.ErrorAs(t, err, &parseErr) {
+		assert.Equal(t, "no_matched_entries", parseErr.Code)
+		assert.Empty(t, parseErr.Suggestions)
+	}
+}
+
+func TestNewExample_SpellingSuggestions(t *testing.T) {
+	input := validTestInput
+	input.Text = "1Uvan 2a 3oe 4(uvan soli|soli) 5lu 6fpoom."
+	input.LookupFilter = nil
+
+	_, err := NewExample(context.Background(), input, spellingTestDict)
+	var exampleErr ExampleError
+	if assert.ErrorAs(t, err, &exampleErr) {
+		assert.Equal(t, "6", exampleErr.Key)
+		assert.Equal(t, []string{"fpom"}, exampleErr.Suggestions)
+	}
+}